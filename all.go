@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// defaultStructNameTemplate names the mock of Persister PersisterMock.
+const defaultStructNameTemplate = "{{.Interface}}Mock"
+
+// structNameData is passed to the template that names the mock structs.
+type structNameData struct {
+	Interface string // Name of the interface, e.g. Persister.
+	Stem      string // Name of the interface without the -er suffix, e.g. Persist.
+	Package   string // Name of the package of the interface, e.g. repository.
+}
+
+// allOptions selects the interfaces that get a mock when all interfaces of a package are mocked at once.
+type allOptions struct {
+	newOptions
+	structName *template.Template
+	include    *regexp.Regexp // Only interfaces whose name matches are mocked, all if nil.
+	exclude    *regexp.Regexp // Interfaces whose name matches are not mocked.
+}
+
+// newAllOptions parses the struct name template and the regular expressions. Empty expressions are ignored.
+func newAllOptions(opts newOptions, structName, include, exclude string) (*allOptions, error) {
+	all := &allOptions{newOptions: opts}
+
+	var err error
+	all.structName, err = template.New("struct").Parse(structName)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid struct name template")
+	}
+	// Try the template once, so mistakes are reported before anything is generated.
+	err = all.structName.Execute(ioutil.Discard, structNameData{})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid struct name template")
+	}
+	if include != "" {
+		all.include, err = regexp.Compile(include)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid include pattern")
+		}
+	}
+	if exclude != "" {
+		all.exclude, err = regexp.Compile(exclude)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid exclude pattern")
+		}
+	}
+	return all, nil
+}
+
+// selected reports whether the interface should get a mock.
+func (o *allOptions) selected(iface *Interface) bool {
+	if !token.IsExported(iface.Name) {
+		return false
+	}
+	if o.include != nil && !o.include.MatchString(iface.Name) {
+		return false
+	}
+	return o.exclude == nil || !o.exclude.MatchString(iface.Name)
+}
+
+// mockStructName returns the name of the mock struct for the interface as defined by the template.
+func (o *allOptions) mockStructName(iface *Interface) (string, error) {
+	data := structNameData{Interface: iface.Name, Stem: iface.Name, Package: iface.Pkg.Name()}
+	if len(iface.Name) > 2 && strings.HasSuffix(iface.Name, "er") {
+		data.Stem = strings.TrimSuffix(iface.Name, "er")
+	}
+
+	buf := &bytes.Buffer{}
+	err := o.structName.Execute(buf, data)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to execute struct name template")
+	}
+	if !token.IsIdentifier(buf.String()) {
+		return "", fmt.Errorf("struct name template results in the invalid name %q", buf.String())
+	}
+	return buf.String(), nil
+}
+
+// planAllMocks returns a batch item for every exported interface and function type in the packages that match
+// the pattern and do not have a mock yet. It also returns the number of interfaces that were skipped because
+// they already have one.
+func planAllMocks(pattern string, opts *allOptions) ([]batchItem, int, error) {
+	pkgs, err := loadPackages(pattern)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := []batchItem{}
+	skipped := 0
+	for _, pkg := range pkgs {
+		dir := relativePath(filepath.Dir(pkg.GoFiles[0]))
+		for _, iface := range packageInterfaces(pkg.Types) {
+			if !opts.selected(iface) {
+				continue
+			}
+
+			_, err := opts.layout.existingMock(dir, iface)
+			if err == nil {
+				skipped++
+				continue
+			}
+			if !noMock(err) {
+				return nil, 0, errors.Wrap(err, "failed to read existing file(s)")
+			}
+
+			iface := iface
+			items = append(items, batchItem{name: interfaceID(iface), plan: func() (*mockUpdate, error) {
+				structName, err := opts.mockStructName(iface)
+				if err != nil {
+					return nil, err
+				}
+				return planInterfaceMock(dir, iface, structName, opts.newOptions)
+			}})
+		}
+	}
+	return items, skipped, nil
+}
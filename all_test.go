@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockStructName(t *testing.T) {
+	iface, err := findInterface("./test/inputnew/example/types.go", "Exampler")
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		defaultStructNameTemplate: "ExamplerMock",
+		"{{.Stem}}Mock":           "ExamplMock",
+		"Mock{{.Interface}}":      "MockExampler",
+		"{{.Package}}Mock":        "exampleMock",
+	}
+	for tmpl, expected := range tests {
+		opts, err := newAllOptions(newOptions{}, tmpl, "", "")
+		require.NoError(t, err)
+		actual, err := opts.mockStructName(iface)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+
+	opts, err := newAllOptions(newOptions{}, "{{.Interface}} Mock", "", "")
+	require.NoError(t, err)
+	_, err = opts.mockStructName(iface)
+	assert.EqualError(t, err, `struct name template results in the invalid name "Exampler Mock"`)
+
+	_, err = newAllOptions(newOptions{}, "{{.Name}}", "", "")
+	assert.Error(t, err)
+	_, err = newAllOptions(newOptions{}, defaultStructNameTemplate, "(", "")
+	assert.Error(t, err)
+}
+
+func TestSelected(t *testing.T) {
+	pkg, err := loadPackage("./test/inputnew/example")
+	require.NoError(t, err)
+	ifaces := packageInterfaces(pkg.Types)
+	require.Len(t, ifaces, 2)
+
+	opts, err := newAllOptions(newOptions{}, defaultStructNameTemplate, "", "")
+	require.NoError(t, err)
+	assert.True(t, opts.selected(ifaces[0]))
+	assert.True(t, opts.selected(ifaces[1]))
+
+	opts, err = newAllOptions(newOptions{}, defaultStructNameTemplate, "er$", "")
+	require.NoError(t, err)
+	assert.True(t, opts.selected(ifaces[0]))
+	assert.False(t, opts.selected(ifaces[1]))
+
+	opts, err = newAllOptions(newOptions{}, defaultStructNameTemplate, "", "^Some")
+	require.NoError(t, err)
+	assert.True(t, opts.selected(ifaces[0]))
+	assert.False(t, opts.selected(ifaces[1]))
+}
+
+func TestNewAllCommand(t *testing.T) {
+	cleanup(t)
+	defer cleanup(t)
+
+	code, stdout, stderr := runCLI("new", "-all", "-struct", "TestMock", "-include", "^Exampler$", "./test/inputnew/example")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, "Generating 1 mocks...\n")
+	assert.Contains(t, stdout, "test/inputnew/example/examplemock/testmock.go (github.com/fastbill/go-mock-gen/test/inputnew/example.Exampler) created\n")
+	expected, err := ioutil.ReadFile("./test/expectednew/result.go")
+	require.NoError(t, err, "error in test setup")
+	actual, err := ioutil.ReadFile("./test/inputnew/example/examplemock/testmock.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+
+	// Interfaces that already have a mock are skipped.
+	code, stdout, stderr = runCLI("new", "-all", "./test/inputnew/...")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, "Skipping 1 interfaces that already have a mock.\nGenerating 1 mocks...\n")
+	assert.FileExists(t, "./test/inputnew/example/examplemock/someotherinterfacemock.go")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// archiveHeader starts the section with the archived methods at the end of a mock file or in the sidecar file.
+const archiveHeader = "// Orphaned methods archived by go-mock-gen. They are not part of the mock anymore.\n" +
+	"// Port the custom logic that is still needed and delete them afterwards."
+
+// now returns the current time, it is replaced in tests.
+var now = time.Now
+
+// archivedMethod is a method of the existing mock that was removed or regenerated during the update.
+type archivedMethod struct {
+	pos  token.Pos
+	code string
+}
+
+// archive remembers the method as commented-out code annotated with the reason and the date.
+func (mg *merger) archive(fn *ast.FuncDecl, reason string) error {
+	if mg.opts.archive == "" {
+		return nil
+	}
+
+	code, err := mg.existing.print(fn)
+	if err != nil {
+		return err
+	}
+
+	lines := []string{fmt.Sprintf("// %s %s on %s:", fn.Name.Name, reason, now().Format("2006-01-02"))}
+	for _, line := range strings.Split(code, "\n") {
+		lines = append(lines, strings.TrimRight("// "+line, " "))
+	}
+	mg.archived = append(mg.archived, archivedMethod{pos: fn.Pos(), code: strings.Join(lines, "\n")})
+	return nil
+}
+
+// archiveRegenerated archives the existing method if it was replaced by the generated one
+// although its body was customized.
+func (mg *merger) archiveRegenerated(existingFn, newFn *ast.FuncDecl) error {
+	if mg.opts.archive == "" {
+		return nil
+	}
+
+	generated, err := mg.generated.print(newFn)
+	if err != nil {
+		return err
+	}
+	// If adapting the old method mechanically leads to the generated one it was not customized.
+	rewritten, _ := rewriteMethod(mg.existing, existingFn, mg.generated, newFn)
+	if rewritten == generated {
+		return nil
+	}
+
+	return mg.archive(existingFn, "was regenerated because its signature changed")
+}
+
+// archivedMethods returns the archived methods in the order they appeared in the existing mock.
+func (mg *merger) archivedMethods() []string {
+	sort.Slice(mg.archived, func(i, j int) bool {
+		return mg.archived[i].pos < mg.archived[j].pos
+	})
+
+	methods := []string{}
+	for _, method := range mg.archived {
+		methods = append(methods, method.code)
+	}
+	return methods
+}
+
+// archivePath returns the path of the sidecar file of the given mock file.
+func archivePath(mockPath string) string {
+	return mockPath + ".orphaned"
+}
+
+// writeArchive appends the archived methods to the sidecar file of the mock.
+func writeArchive(mockPath string, archived []string) error {
+	if len(archived) == 0 {
+		return nil
+	}
+
+	_, after, err := archiveContent(mockPath, archived)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(archivePath(mockPath), []byte(after), 0644) //nolint: gosec
+	if err != nil {
+		return errors.Wrap(err, "failed to write archive")
+	}
+	return nil
+}
+
+// archiveContent returns the content of the sidecar file of the mock before and after appending the archived methods.
+func archiveContent(mockPath string, archived []string) (string, string, error) {
+	// nolint: gosec
+	blob, err := ioutil.ReadFile(archivePath(mockPath))
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", errors.Wrap(err, "failed to read archive")
+	}
+
+	parts := []string{archiveHeader}
+	if len(blob) > 0 {
+		parts = []string{strings.TrimRight(string(blob), "\n")}
+	}
+	parts = append(parts, archived...)
+
+	return string(blob), strings.Join(parts, "\n\n") + "\n", nil
+}
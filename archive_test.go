@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const archiveExisting = rewritePreambleWithoutModel + `
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	args := m.Called(id)
+
+	return "custom", args.Error(1)
+}
+
+// Update is a mock implementation of example.Exampler#Update.
+func (m *TestMock) Update(id int) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id int) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+`
+
+const archiveGenerated = rewritePreambleWithoutModel + `
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int, force bool) (string, error) {
+	args := m.Called(id, force)
+
+	return args.String(0), args.Error(1)
+}
+
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id int, force bool) error {
+	args := m.Called(id, force)
+
+	return args.Error(0)
+}
+`
+
+const archiveMethods = `// Get was regenerated because its signature changed on 2022-05-04:
+// // Get is a mock implementation of example.Exampler#Get.
+// func (m *TestMock) Get(id int) (string, error) {
+// 	args := m.Called(id)
+//
+// 	return "custom", args.Error(1)
+// }
+
+// Update was removed from the interface on 2022-05-04:
+// // Update is a mock implementation of example.Exampler#Update.
+// func (m *TestMock) Update(id int) error {
+// 	args := m.Called(id)
+//
+// 	return args.Error(0)
+// }`
+
+func TestArchive(t *testing.T) {
+	now = func() time.Time { return time.Date(2022, 5, 4, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	merged := archiveGenerated[len(rewritePreambleWithoutModel):]
+	expected := rewritePreambleWithoutModel + merged + "\n" + archiveHeader + "\n\n" + archiveMethods + "\n"
+
+	existing, err := parseMock("existing.go", archiveExisting)
+	require.NoError(t, err)
+	result, err := calcResultMock(existing, archiveGenerated, "TestMock", packageImporter{}, updateOptions{archive: archiveSection})
+	require.NoError(t, err)
+	// Delete was not customized so it is not archived.
+	assert.Equal(t, expected, result.source)
+	assert.Len(t, result.archived, 2)
+
+	// The next update keeps the section at the end and adds new methods in front of it.
+	existing, err = parseMock("existing.go", result.source)
+	require.NoError(t, err)
+	result, err = calcResultMock(existing, archiveGenerated+`
+// Find is a mock implementation of example.Exampler#Find.
+func (m *TestMock) Find() error {
+	args := m.Called()
+
+	return args.Error(0)
+}
+`, "TestMock", packageImporter{}, updateOptions{archive: archiveSection})
+	require.NoError(t, err)
+	assert.Equal(t, rewritePreambleWithoutModel+merged+`
+// Find is a mock implementation of example.Exampler#Find.
+func (m *TestMock) Find() error {
+	args := m.Called()
+
+	return args.Error(0)
+}
+
+`+archiveHeader+"\n\n"+archiveMethods+"\n", result.source)
+	assert.Empty(t, result.archived)
+
+	// Without the option nothing is archived.
+	existing, err = parseMock("existing.go", archiveExisting)
+	require.NoError(t, err)
+	result, err = calcResultMock(existing, archiveGenerated, "TestMock", packageImporter{}, updateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, archiveGenerated, result.source)
+	assert.Empty(t, result.archived)
+}
+
+func TestWriteArchive(t *testing.T) {
+	mockPath := filepath.Join(t.TempDir(), "testmock.go")
+	require.NoError(t, writeArchive(mockPath, nil))
+	assert.NoFileExists(t, archivePath(mockPath))
+
+	require.NoError(t, writeArchive(mockPath, []string{"// A", "// B"}))
+	require.NoError(t, writeArchive(mockPath, []string{"// C"}))
+
+	blob, err := ioutil.ReadFile(archivePath(mockPath))
+	require.NoError(t, err)
+	assert.Equal(t, archiveHeader+"\n\n// A\n\n// B\n\n// C\n", string(blob))
+}
@@ -0,0 +1,686 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+// Exit codes of the command.
+const (
+	exitOK      = 0
+	exitFailure = 1 // The command failed or found stale mocks.
+	exitUsage   = 2 // The command was called with invalid arguments.
+)
+
+// errStale is returned by check if mocks are out of date. The details are reported by the command itself.
+var errStale = errors.New("mocks are out of date")
+
+// usageError is returned for invalid arguments. The usage of the command is printed together with it.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// command is a subcommand like new or update.
+type command struct {
+	name        string
+	arguments   string // Positional arguments shown in the usage.
+	description string
+	// setup registers the flags of the command and returns the function that runs it with the positional arguments.
+	setup func(fs *flag.FlagSet) func(args []string) error
+}
+
+// cli runs the subcommands. Everything it prints goes to the configured writers so it can be tested.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func newCLI() *cli {
+	return &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+}
+
+func (c *cli) commands() []*command {
+	return []*command{
+		{name: "new", arguments: "<interface> <mockStructName> | -all <pattern>", description: "Generate a new mock or mocks for all interfaces of the packages.", setup: c.newCommand},
+		{name: "update", arguments: "<interface> | <dir>/...", description: "Update an existing mock or all mocks below a directory.", setup: c.updateCommand},
+		{name: "check", arguments: "<interface> | <packageDir>", description: "Fail if existing mocks are out of date, by default all mocks of the package.", setup: c.checkCommand},
+		{name: "list", arguments: "<packageDir>", description: "List the interfaces and function types of a package and their mocks.", setup: c.listCommand},
+		{name: "sync", arguments: "", description: "Create and update all mocks listed in the config file.", setup: c.syncCommand},
+		{name: "diff", arguments: "<interface>", description: "Print the changes an update would make as a unified diff, like update -diff.", setup: c.diffCommand},
+	}
+}
+
+func (c *cli) command(name string) *command {
+	for _, cmd := range c.commands() {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// run executes the command given by the arguments and returns the exit code.
+func (c *cli) run(args []string) int {
+	if len(args) == 0 {
+		c.usage()
+		return exitUsage
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		c.usage()
+		return exitOK
+	}
+
+	cmd := c.command(args[0])
+	if cmd == nil {
+		legacy, ok := legacyArgs(args)
+		if !ok {
+			fmt.Fprintf(c.stderr, "Error: unknown command %q\n\n", args[0])
+			c.usage()
+			return exitUsage
+		}
+		fmt.Fprintf(c.stderr, "Calling go-mock-gen without a command is deprecated, use \"go-mock-gen %s\" instead.\n", strings.Join(legacy, " "))
+		args = legacy
+		cmd = c.command(args[0])
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() { c.commandUsage(cmd, fs) }
+	runCommand := cmd.setup(fs)
+
+	positional, err := parseFlags(fs, args[1:])
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		// The flag package already printed the error and the usage.
+		return exitUsage
+	}
+
+	err = runCommand(positional)
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(c.stderr, "Error: %s\n\n", err)
+		fs.Usage()
+		return exitUsage
+	case err == errStale:
+		return exitFailure
+	default:
+		fmt.Fprintf(c.stderr, "Error: %s\n", err)
+		return exitFailure
+	}
+}
+
+// legacyArgs converts the arguments of the old command line without commands, e.g.
+// <interfaceFile> <interfaceName> <mockStructName> or <interfaceFile> <interfaceName> -f. The first argument
+// must be an existing Go file or directory, so mistyped commands are not taken for a file.
+func legacyArgs(args []string) ([]string, bool) {
+	if len(args) < 3 {
+		return nil, false
+	}
+	info, err := os.Stat(args[0])
+	if err != nil || (!info.IsDir() && filepath.Ext(args[0]) != ".go") {
+		return nil, false
+	}
+	for i, arg := range args {
+		if arg == "-f" {
+			return append(append([]string{"update"}, args[:i]...), args[i+1:]...), true
+		}
+	}
+	return append([]string{"new"}, args...), true
+}
+
+// parseFlags parses the flags of the command. In contrast to flag.Parse, flags may also follow
+// the positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// interfaceArgs splits the arguments into the interface and the given number of further arguments. The interface is
+// either a file or directory followed by the interface name or an import path like net/http.RoundTripper.
+// The name is empty in the latter case.
+func interfaceArgs(cmd string, args []string, rest int) (string, string, []string, error) {
+	switch {
+	case len(args) == rest+2:
+		return args[0], args[1], args[2:], nil
+	case len(args) == rest+1 && qualifiedInterface(args[0]):
+		return args[0], "", args[1:], nil
+	default:
+		return "", "", nil, usagef("%s expects %d arguments, or %d if the first one is an import path with interface name, but got %d",
+			cmd, rest+2, rest+1, len(args))
+	}
+}
+
+// expectArgs returns a usage error if the number of positional arguments does not match.
+func expectArgs(cmd string, args []string, n int) error {
+	if len(args) != n {
+		return usagef("%s expects %d arguments but got %d", cmd, n, len(args))
+	}
+	return nil
+}
+
+func (c *cli) usage() {
+	fmt.Fprintf(c.stderr, "Usage: go-mock-gen <command> [options] <arguments>\n\nCommands:\n")
+	w := tabwriter.NewWriter(c.stderr, 0, 8, 2, ' ', 0)
+	for _, cmd := range c.commands() {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.arguments, cmd.description)
+	}
+	w.Flush() //nolint: errcheck, gosec
+	fmt.Fprintf(c.stderr, "\n<interface> is a file or directory of the package followed by the interface name,\n")
+	fmt.Fprintf(c.stderr, "or the import path and name of the interface, e.g. net/http.RoundTripper.\n")
+	fmt.Fprintf(c.stderr, "\nRun \"go-mock-gen <command> -h\" for the options of a command.\n")
+	fmt.Fprintf(c.stderr, "Example: go-mock-gen new ./pkg/gateway/gateway.go Gatewayer Gateway\n")
+	fmt.Fprintf(c.stderr, "Example: go-mock-gen update -strategy rewrite ./pkg/gateway/gateway.go Gatewayer\n")
+	fmt.Fprintf(c.stderr, "Example: go-mock-gen new io.ReadCloser ReadCloser\n")
+}
+
+func (c *cli) commandUsage(cmd *command, fs *flag.FlagSet) {
+	fmt.Fprintf(c.stderr, "Usage: go-mock-gen %s [options] %s\n\n%s\n", cmd.name, cmd.arguments, cmd.description)
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintf(c.stderr, "\nOptions:\n")
+		fs.PrintDefaults()
+	}
+}
+
+func (c *cli) newCommand(fs *flag.FlagSet) func(args []string) error {
+	receiverName := fs.String("receiver", defaultReceiverName, "name of the receiver variable of the mock methods")
+	dryRun := dryRunFlag(fs)
+	all := fs.Bool("all", false, "create mocks for all exported interfaces and function types of the packages that match the pattern")
+	structName := fs.String("struct", defaultStructNameTemplate, "template for the names of the mock structs with -all, {{.Stem}} is the interface name without -er suffix")
+	include := fs.String("include", "", "with -all only mock the interfaces whose name matches the regular expression")
+	exclude := fs.String("exclude", "", "with -all do not mock the interfaces whose name matches the regular expression")
+	mockLayout := layoutFlags(fs, true)
+	resolveAliases := aliasFlag(fs)
+
+	return func(args []string) error {
+		newOpts := newOptions{receiverName: *receiverName, resolveAliases: *resolveAliases, layout: *mockLayout}
+		err := newOpts.validate()
+		if err != nil {
+			return usagef("%s", err)
+		}
+
+		if *all {
+			err := expectArgs("new -all", args, 1)
+			if err != nil {
+				return err
+			}
+			opts, err := newAllOptions(newOpts, *structName, *include, *exclude)
+			if err != nil {
+				return usagef("%s", err)
+			}
+			return c.newAll(args[0], opts, *dryRun)
+		}
+
+		target, name, args, err := interfaceArgs("new", args, 1)
+		if err != nil {
+			return err
+		}
+
+		if *dryRun {
+			mock, err := planNewMock(target, name, args[0], newOpts)
+			if err != nil {
+				return err
+			}
+			return c.printDiff(mock.path, mock.before, mock.after)
+		}
+
+		fmt.Fprintln(c.stdout, "Generating new mock...")
+		err = generateNewMock(target, name, args[0], newOpts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.stdout, "Success!")
+		return nil
+	}
+}
+
+// newAll creates mocks for all interfaces of the packages that match the pattern and do not have a mock yet.
+func (c *cli) newAll(pattern string, opts *allOptions, dryRun bool) error {
+	items, skipped, err := planAllMocks(pattern, opts)
+	if err != nil {
+		return err
+	}
+
+	progress, _ := c.outputs(formatText, dryRun)
+	if skipped > 0 {
+		fmt.Fprintf(progress, "Skipping %d interfaces that already have a mock.\n", skipped)
+	}
+	return c.runBatch("Generating", items, dryRun, formatText)
+}
+
+// dryRunFlag registers -diff and its alias -dry-run.
+func dryRunFlag(fs *flag.FlagSet) *bool {
+	dryRun := false
+	fs.BoolVar(&dryRun, "diff", false, "print the changes as a unified diff instead of writing them")
+	fs.BoolVar(&dryRun, "dry-run", false, "alias for -diff")
+	return &dryRun
+}
+
+// printDiff prints the changes of a file as a unified diff. An empty before means the file is new.
+func (c *cli) printDiff(path, before, after string) error {
+	path = diffPath(path)
+	from := "a/" + path
+	if before == "" {
+		from = "/dev/null"
+	}
+
+	diff, err := unifiedDiff(from, "b/"+path, before, after)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(c.stdout, diff)
+	return errors.Wrap(err, "failed to write diff")
+}
+
+// diffPath returns the path of a file in the diff. Absolute paths are made relative to the working
+// directory if possible, like git does it.
+func diffPath(path string) string {
+	return strings.TrimPrefix(filepath.ToSlash(relativePath(path)), "/")
+}
+
+// printUpdateDiff prints the changes of an update including the ones to the archive sidecar file.
+func (c *cli) printUpdateDiff(update *mockUpdate, archive string) error {
+	err := c.printDiff(update.path, update.before, update.after)
+	if err != nil {
+		return err
+	}
+	if archive != archiveFile || len(update.archived) == 0 {
+		return nil
+	}
+
+	before, after, err := archiveContent(update.path, update.archived)
+	if err != nil {
+		return err
+	}
+	return c.printDiff(archivePath(update.path), before, after)
+}
+
+func strategyFlag(fs *flag.FlagSet) *string {
+	return fs.String("strategy", strategyRegenerate, "how to update methods whose signature changed: "+strategyRegenerate+" or "+strategyRewrite)
+}
+
+// layoutFlags registers the options of the mock layout. Only the output folder is needed to find existing mocks.
+func layoutFlags(fs *flag.FlagSet, create bool) *layout {
+	l := &layout{}
+	fs.StringVar(&l.output, "output", defaultOutputTemplate, "template of the folder of the mock, with {{.Dir}}, {{.Package}} and {{.Interface}}")
+	fs.BoolVar(&l.inPackage, "in-package", false, "the mock is part of the package of the interface instead of a separate mock package")
+	fs.StringVar(&l.test, "test", "", "put the mock into a _test.go file of the package of the interface: "+testInternal+" (same package) or "+testExternal+" (<package>_test)")
+	if create {
+		fs.StringVar(&l.pkg, "package", defaultPackageTemplate, "template of the package name of the mock, with {{.Package}} and {{.Interface}}")
+		fs.StringVar(&l.file, "file", defaultFileTemplate, "template of the file name of the mock, with {{.Struct}} and the functions lower and snake")
+	}
+	return l
+}
+
+func aliasFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("resolve-aliases", false, "use the types that aliases stand for instead of the aliases in the signatures of the mock")
+}
+
+func archiveFlag(fs *flag.FlagSet) *string {
+	return fs.String("archive", "", "keep customized methods that are removed or regenerated as comments: "+archiveSection+" (at the end of the mock) or "+archiveFile+" (in <mockFile>.orphaned)")
+}
+
+func formatFlag(fs *flag.FlagSet) *string {
+	return fs.String("format", formatText, "format of the change report: "+formatText+" or "+formatJSON)
+}
+
+func checkFormat(format string) error {
+	if format != formatText && format != formatJSON {
+		return usagef("unknown format %q", format)
+	}
+	return nil
+}
+
+func (c *cli) updateCommand(fs *flag.FlagSet) func(args []string) error {
+	strategy := strategyFlag(fs)
+	archive := archiveFlag(fs)
+	interactive := fs.Bool("interactive", false, "ask how to update each customized method whose signature changed")
+	format := formatFlag(fs)
+	mockLayout := layoutFlags(fs, false)
+	resolveAliases := aliasFlag(fs)
+	dryRun := dryRunFlag(fs)
+
+	return func(args []string) error {
+		var target, name string
+		if len(args) != 1 || !strings.HasSuffix(args[0], "...") {
+			var err error
+			target, name, _, err = interfaceArgs("update", args, 0)
+			if err != nil {
+				return err
+			}
+		}
+		err := checkFormat(*format)
+		if err != nil {
+			return err
+		}
+		if *dryRun && *format == formatJSON {
+			return usagef("-diff can not be combined with -format %s", formatJSON)
+		}
+
+		progress, reportOut := c.outputs(*format, *dryRun)
+		opts := updateOptions{strategy: *strategy, archive: *archive, layout: *mockLayout, resolveAliases: *resolveAliases}
+		if *interactive {
+			opts.resolver = newPrompter(c.stdin, progress)
+		}
+		if target == "" {
+			return c.updateAll(args[0], opts, *dryRun, *format)
+		}
+
+		fmt.Fprintln(progress, "Updating existing mock...")
+
+		var report *changeReport
+		if *dryRun {
+			update, err := planUpdate(target, name, opts)
+			if err != nil {
+				return err
+			}
+			err = c.printUpdateDiff(update, opts.archive)
+			if err != nil {
+				return err
+			}
+			report = update.report
+		} else {
+			report, err = updateMock(target, name, opts)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = writeReports(reportOut, []*changeReport{report}, *format)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(progress, "Success!")
+		return nil
+	}
+}
+
+func (c *cli) checkCommand(fs *flag.FlagSet) func(args []string) error {
+	strategy := strategyFlag(fs)
+	format := formatFlag(fs)
+	mockLayout := layoutFlags(fs, false)
+	resolveAliases := aliasFlag(fs)
+
+	return func(args []string) error {
+		if len(args) != 1 && len(args) != 2 {
+			return usagef("check expects 1 or 2 arguments but got %d", len(args))
+		}
+		err := checkFormat(*format)
+		if err != nil {
+			return err
+		}
+
+		opts := updateOptions{strategy: *strategy, layout: *mockLayout, resolveAliases: *resolveAliases}
+		var updates []*mockUpdate
+		if len(args) == 2 || qualifiedInterface(args[0]) {
+			target, name, _, err := interfaceArgs("check", args, 0)
+			if err != nil {
+				return err
+			}
+			update, err := planUpdate(target, name, opts)
+			if err != nil {
+				return err
+			}
+			updates = append(updates, update)
+		} else {
+			updates, err = planPackageUpdates(packageDir(args[0]), opts)
+			if err != nil {
+				return err
+			}
+		}
+
+		stale := []*changeReport{}
+		for _, update := range updates {
+			if update.stale() {
+				stale = append(stale, update.report)
+			}
+		}
+		err = writeReports(c.stdout, stale, *format)
+		if err != nil {
+			return err
+		}
+		if len(stale) == 0 {
+			fmt.Fprintf(c.stderr, "All %d mocks are up to date.\n", len(updates))
+			return nil
+		}
+
+		fmt.Fprintf(c.stderr, "%d of %d mocks are out of date, run \"go-mock-gen update\" to update them.\n", len(stale), len(updates))
+		return errStale
+	}
+}
+
+// planPackageUpdates plans the updates of all mocks of the interfaces in the package.
+func planPackageUpdates(dir string, opts updateOptions) ([]*mockUpdate, error) {
+	pkg, err := loadPackage(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := []*mockUpdate{}
+	for _, iface := range packageInterfaces(pkg.Types) {
+		update, err := planInterfaceUpdate(dir, iface, opts)
+		if noMock(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to check mock of "+iface.Name)
+		}
+		updates = append(updates, update)
+	}
+
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("no mocks found for the package in %s", dir)
+	}
+	return updates, nil
+}
+
+func (c *cli) diffCommand(fs *flag.FlagSet) func(args []string) error {
+	strategy := strategyFlag(fs)
+	archive := archiveFlag(fs)
+	mockLayout := layoutFlags(fs, false)
+	resolveAliases := aliasFlag(fs)
+
+	return func(args []string) error {
+		target, name, _, err := interfaceArgs("diff", args, 0)
+		if err != nil {
+			return err
+		}
+
+		opts := updateOptions{strategy: *strategy, archive: *archive, layout: *mockLayout, resolveAliases: *resolveAliases}
+		update, err := planUpdate(target, name, opts)
+		if err != nil {
+			return err
+		}
+		return c.printUpdateDiff(update, opts.archive)
+	}
+}
+
+func (c *cli) listCommand(fs *flag.FlagSet) func(args []string) error {
+	mockLayout := layoutFlags(fs, false)
+
+	return func(args []string) error {
+		err := expectArgs("list", args, 1)
+		if err != nil {
+			return err
+		}
+
+		dir := packageDir(args[0])
+		pkg, err := loadPackage(dir)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+		for _, iface := range packageInterfaces(pkg.Types) {
+			mock, err := mockLayout.existingMock(dir, iface)
+			switch {
+			case err == nil && mock.structName != "":
+				fmt.Fprintf(w, "%s\t%s\t%s\n", iface.Name, mock.path, mock.structName)
+			case err == nil:
+				fmt.Fprintf(w, "%s\t%s\n", iface.Name, mock.path)
+			case noMock(err):
+				fmt.Fprintf(w, "%s\t-\n", iface.Name)
+			default:
+				fmt.Fprintf(w, "%s\t%s\n", iface.Name, err)
+			}
+		}
+		return errors.Wrap(w.Flush(), "failed to write list")
+	}
+}
+
+func (c *cli) syncCommand(fs *flag.FlagSet) func(args []string) error {
+	configFile := fs.String("config", defaultConfigFile, "path of the config file")
+	format := formatFlag(fs)
+	dryRun := dryRunFlag(fs)
+
+	return func(args []string) error {
+		err := expectArgs("sync", args, 0)
+		if err != nil {
+			return err
+		}
+		err = checkFormat(*format)
+		if err != nil {
+			return err
+		}
+		if *dryRun && *format == formatJSON {
+			return usagef("-diff can not be combined with -format %s", formatJSON)
+		}
+
+		cfg, err := readConfig(*configFile)
+		if err != nil {
+			return err
+		}
+
+		items := []batchItem{}
+		for i := range cfg.Mocks {
+			mock := &cfg.Mocks[i]
+			items = append(items, batchItem{name: mock.String(), archive: mock.Archive, plan: func() (*mockUpdate, error) {
+				return planSync(mock)
+			}})
+		}
+		return c.runBatch("Syncing", items, *dryRun, *format)
+	}
+}
+
+// batchItem is a mock that is created or updated together with others.
+type batchItem struct {
+	name    string // Identifies the mock in error messages.
+	archive string
+	plan    func() (*mockUpdate, error)
+}
+
+// runBatch plans and writes the mocks one after another. Errors are reported per mock and do not stop the others.
+// Only the mocks that changed are reported to keep the output short for large batches.
+func (c *cli) runBatch(verb string, items []batchItem, dryRun bool, format string) error {
+	progress, reportOut := c.outputs(format, dryRun)
+	fmt.Fprintf(progress, "%s %d mocks...\n", verb, len(items))
+
+	reports := []*changeReport{}
+	failed := 0
+	for _, item := range items {
+		update, err := item.plan()
+		if err == nil && update.stale() {
+			if dryRun {
+				err = c.printUpdateDiff(update, item.archive)
+			} else {
+				err = writeMock(update, item.archive)
+			}
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(c.stderr, "Error: %s: %s\n", item.name, err)
+			continue
+		}
+		if update.stale() {
+			reports = append(reports, update.report)
+		}
+	}
+
+	err := writeReports(reportOut, reports, format)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d mocks failed", failed, len(items))
+	}
+	fmt.Fprintf(progress, "Success! %d of %d mocks changed.\n", len(reports), len(items))
+	return nil
+}
+
+// outputs returns the writers for progress messages and the report. Only the report or the diff is written
+// to stdout in JSON and dry-run mode so it can be processed by other tools.
+func (c *cli) outputs(format string, dryRun bool) (progress io.Writer, report io.Writer) {
+	switch {
+	case dryRun:
+		return c.stderr, c.stderr
+	case format == formatJSON:
+		return c.stderr, c.stdout
+	default:
+		return c.stdout, c.stdout
+	}
+}
+
+// updateAll updates all mocks that are found below the directory of the pattern, e.g. ./... or ./pkg/...
+func (c *cli) updateAll(pattern string, opts updateOptions, dryRun bool, format string) error {
+	root := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+	if root == "" {
+		root = "."
+	}
+
+	refs, err := findMocks(root)
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		return fmt.Errorf("no mocks found in %s", pattern)
+	}
+
+	items := []batchItem{}
+	for _, ref := range refs {
+		ref := ref
+		items = append(items, batchItem{name: ref.String(), archive: opts.archive, plan: func() (*mockUpdate, error) {
+			iface, dir, err := ref.resolve()
+			if err != nil {
+				return nil, err
+			}
+			folder := filepath.Dir(ref.file)
+			refOpts := opts
+			refOpts.layout = layout{output: folder, inPackage: sameDir(folder, dir)}
+			return planInterfaceUpdate(dir, iface, refOpts)
+		}})
+	}
+	return c.runBatch("Updating", items, dryRun, format)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runCLI runs the command line with the given arguments and returns the exit code and the output.
+func runCLI(args ...string) (int, string, string) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	c := &cli{stdin: strings.NewReader(""), stdout: stdout, stderr: stderr}
+	code := c.run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLIUsageErrors(t *testing.T) {
+	tests := map[string]struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		"no arguments":      {args: nil, code: exitUsage, stderr: "Usage: go-mock-gen <command>"},
+		"help":              {args: []string{"help"}, code: exitOK, stderr: "Commands:"},
+		"unknown command":   {args: []string{"generate"}, code: exitUsage, stderr: `Error: unknown command "generate"`},
+		"missing argument":  {args: []string{"new", "./types.go", "Exampler"}, code: exitUsage, stderr: "Error: new expects 3 arguments, or 2 if the first one is an import path with interface name, but got 2"},
+		"unknown flag":      {args: []string{"update", "-force", "./types.go", "Exampler"}, code: exitUsage, stderr: "flag provided but not defined: -force"},
+		"unknown format":    {args: []string{"update", "./types.go", "Exampler", "-format", "xml"}, code: exitUsage, stderr: `Error: unknown format "xml"`},
+		"command help":      {args: []string{"update", "-h"}, code: exitOK, stderr: "-strategy string"},
+		"invalid receiver":  {args: []string{"new", "-receiver", "1x", "./test/inputnew/example", "Exampler", "TestMock"}, code: exitUsage, stderr: `Error: the receiver name "1x" is not a valid identifier`},
+		"reserved receiver": {args: []string{"new", "-receiver", "args", "./test/inputnew/example", "Exampler", "TestMock"}, code: exitUsage, stderr: `Error: the receiver name "args" is used by the generated code`},
+		"receiver import":   {args: []string{"new", "-diff", "-receiver", "model", "./test/inputnew/example", "Exampler", "TestMock"}, code: exitFailure, stderr: "the receiver name model is also the name of an imported package"},
+		"failure":           {args: []string{"update", "./test/inputfix/example/types.go", "Missing"}, code: exitFailure, stderr: "Error: problem finding interface: Missing is not declared"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			code, _, stderr := runCLI(test.args...)
+			assert.Equal(t, test.code, code)
+			assert.Contains(t, stderr, test.stderr)
+		})
+	}
+}
+
+func TestLegacyArgs(t *testing.T) {
+	file := "./test/inputnew/example/types.go"
+	args, ok := legacyArgs([]string{file, "Exampler", "TestMock"})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"new", file, "Exampler", "TestMock"}, args)
+
+	args, ok = legacyArgs([]string{file, "Exampler", "-f", "-strategy", "rewrite"})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"update", file, "Exampler", "-strategy", "rewrite"}, args)
+
+	_, ok = legacyArgs([]string{file, "Exampler"})
+	assert.False(t, ok)
+
+	// A mistyped command is not taken for a file.
+	_, ok = legacyArgs([]string{"nwe", file, "Exampler", "TestMock"})
+	assert.False(t, ok)
+	_, ok = legacyArgs([]string{"./missing.go", "Exampler", "TestMock"})
+	assert.False(t, ok)
+	_, ok = legacyArgs([]string{"./README.md", "Exampler", "TestMock"})
+	assert.False(t, ok)
+}
+
+func TestParseFlags(t *testing.T) {
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	strategy := strategyFlag(fs)
+	interactive := fs.Bool("interactive", false, "")
+
+	args, err := parseFlags(fs, []string{"./types.go", "-strategy", "rewrite", "Exampler", "-interactive"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"./types.go", "Exampler"}, args)
+	assert.Equal(t, strategyRewrite, *strategy)
+	assert.True(t, *interactive)
+}
+
+func TestCheckDiffAndUpdateCommands(t *testing.T) {
+	cleanup(t)
+	err := copy.Copy("./test/inputfix/existing", "./test/inputfix/example/examplemock")
+	require.NoError(t, err, "error in test setup")
+
+	code, stdout, stderr := runCLI("check", "./test/inputfix/example/types.go", "Exampler")
+	assert.Equal(t, exitFailure, code)
+	assert.Equal(t, "1 of 1 mocks are out of date, run \"go-mock-gen update\" to update them.\n", stderr)
+	assert.Equal(t, `test/inputfix/example/examplemock/testmock.go (github.com/fastbill/go-mock-gen/test/inputfix/example.Exampler)
+  added:       FunctionD
+  removed:     FunctionA
+  regenerated: FunctionC
+  kept:        FunctionZ (unchanged)
+  directive:   mockgen:interface added
+`, stdout)
+
+	// Without an interface all mocks of the package are checked.
+	code, stdout, _ = runCLI("check", "./test/inputfix/example", "-format", "json")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stdout, `"interface": "github.com/fastbill/go-mock-gen/test/inputfix/example.Exampler"`)
+
+	code, stdout, _ = runCLI("diff", "./test/inputfix/example/types.go", "Exampler")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "--- a/test/inputfix/example/examplemock/testmock.go\n+++ b/test/inputfix/example/examplemock/testmock.go\n")
+	assert.Contains(t, stdout, "\n-func (m *TestMock) FunctionA(user *model.StructA) (string, error) {\n")
+
+	code, dryRunStdout, stderr := runCLI("update", "--dry-run", "./test/inputfix/example/types.go", "Exampler")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, stdout, dryRunStdout)
+	assert.Contains(t, stderr, "removed:     FunctionA")
+	existing, err := ioutil.ReadFile("./test/inputfix/existing/testmock.go")
+	require.NoError(t, err, "error in test setup")
+	actual, err := ioutil.ReadFile("./test/inputfix/example/examplemock/testmock.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(existing), string(actual))
+
+	code, stdout, _ = runCLI("update", "./test/inputfix/example/types.go", "Exampler", "-format", "json")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"removed": [`)
+
+	code, stdout, stderr = runCLI("check", "./test/inputfix/example")
+	assert.Equal(t, exitOK, code)
+	assert.Empty(t, stdout)
+	assert.Equal(t, "All 1 mocks are up to date.\n", stderr)
+
+	code, _, stderr = runCLI("check", "./test/inputnew/example")
+	assert.Equal(t, exitFailure, code)
+	assert.Equal(t, "Error: no mocks found for the package in ./test/inputnew/example\n", stderr)
+
+	code, stdout, _ = runCLI("list", "./test/inputfix/example")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "Exampler            test/inputfix/example/examplemock/testmock.go  TestMock\nSomeOtherInterface  -\n", stdout)
+}
+
+func TestCheckMockWithoutDirective(t *testing.T) {
+	cleanup(t)
+	code, _, stderr := runCLI("new", "./test/inputnew/example/types.go", "Exampler", "TestMock")
+	require.Equal(t, exitOK, code, stderr)
+
+	// Mocks of older versions are only missing the directive.
+	path := "./test/inputnew/example/examplemock/testmock.go"
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	legacy := strings.Replace(string(content), "//\n//mockgen:interface github.com/fastbill/go-mock-gen/test/inputnew/example.Exampler struct=TestMock\n", "", 1)
+	require.NotEqual(t, string(content), legacy, "error in test setup")
+	require.NoError(t, ioutil.WriteFile(path, []byte(legacy), 0644), "error in test setup")
+
+	code, stdout, stderr := runCLI("check", "./test/inputnew/example/types.go", "Exampler")
+	assert.Equal(t, exitFailure, code)
+	assert.Equal(t, "1 of 1 mocks are out of date, run \"go-mock-gen update\" to update them.\n", stderr)
+	assert.Equal(t, `test/inputnew/example/examplemock/testmock.go (github.com/fastbill/go-mock-gen/test/inputnew/example.Exampler)
+  kept:        FunctionA (unchanged), FunctionC (unchanged), FunctionZ (unchanged)
+  directive:   mockgen:interface added
+`, stdout)
+	cleanup(t)
+}
+
+func TestNewCommandWithDiff(t *testing.T) {
+	cleanup(t)
+
+	code, stdout, _ := runCLI("new", "-diff", "./test/inputnew/example/types.go", "Exampler", "TestMock")
+	assert.Equal(t, exitOK, code)
+	assert.True(t, strings.HasPrefix(stdout, "--- /dev/null\n+++ b/test/inputnew/example/examplemock/testmock.go\n@@ -0,0 +1,42 @@\n+package examplemock\n"), stdout)
+	assert.NoDirExists(t, "./test/inputnew/example/examplemock")
+}
+
+func TestNewCommandWithImportPath(t *testing.T) {
+	code, stdout, stderr := runCLI("new", "-diff", "io.ReadCloser", "ReadCloser")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, "+++ b/mocks/iomock/readcloser.go\n")
+	assert.Contains(t, stdout, "+//mockgen:interface io.ReadCloser struct=ReadCloser\n")
+	assert.Contains(t, stdout, "+func (m *ReadCloser) Read(p []byte) (int, error) {\n")
+	assert.NoDirExists(t, "./mocks")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// unifiedDiff returns the changes between the two texts in the unified diff format.
+// The result is empty if both texts are equal.
+func unifiedDiff(fromName, toName, from, to string) (string, error) {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(from),
+		B:        splitLines(to),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create diff")
+	}
+	return diff, nil
+}
+
+// splitLines splits the text into lines that keep their line break. In contrast to difflib.SplitLines
+// it does not add an empty line at the end, so the diff of a new file only contains added lines.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
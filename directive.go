@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// The directive links a mock struct to the interface it implements, e.g.
+// //mockgen:interface github.com/some-path/example.Exampler struct=TestMock
+// It is written into the doc comment of the mock struct.
+const directivePrefix = "//mockgen:interface"
+
+var directiveRegex = regexp.MustCompile(`(?m)^` + directivePrefix + ` (\S+?(?:\[.*\])?) struct=(\S+)\s*$`)
+
+// mockDirective is the parsed content of a mockgen:interface directive.
+type mockDirective struct {
+	Interface  string // Import path and name of the interface, e.g. github.com/some-path/example.Exampler, including type arguments of instantiations.
+	StructName string
+}
+
+func interfaceID(iface *Interface) string {
+	return iface.QualifiedName + "." + iface.Name + iface.TypeArgs
+}
+
+func interfaceDirective(iface *Interface, structName string) string {
+	return mockDirective{Interface: interfaceID(iface), StructName: structName}.String()
+}
+
+func (d mockDirective) String() string {
+	return fmt.Sprintf("%s %s struct=%s", directivePrefix, d.Interface, d.StructName)
+}
+
+// parseDirectives returns all directives in the given source code.
+func parseDirectives(content string) []mockDirective {
+	directives := []mockDirective{}
+	for _, match := range directiveRegex.FindAllStringSubmatch(content, -1) {
+		directives = append(directives, mockDirective{Interface: match[1], StructName: match[2]})
+	}
+	return directives
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// legacyMarkerRegex matches the doc comment of mock structs that were generated before the mockgen:interface
+// directive existed, e.g. "TestMock is a mock implementation of the example.Exampler interface."
+var legacyMarkerRegex = regexp.MustCompile(`is a mock implementation of the (\w+)\.(\w+) interface`)
+
+// mockReference is a mock file found in the source tree together with the interface it implements.
+type mockReference struct {
+	file       string
+	importPath string // Only set if the mock has a mockgen:interface directive.
+	pkgName    string // Only set for mocks without directive, the interface package is the parent of the mock folder then.
+	iface      string
+}
+
+func (r *mockReference) String() string {
+	if r.importPath != "" {
+		return r.file + " " + r.importPath + "." + r.iface
+	}
+	return r.file + " " + r.pkgName + "." + r.iface
+}
+
+// findMocks walks the tree below root and returns all mocks that are marked with the mockgen:interface directive
+// or the doc comment of generated mock structs, including mocks in _test.go files. Hidden folders, vendor and
+// testdata are skipped.
+func findMocks(root string) ([]*mockReference, error) {
+	refs := []*mockReference{}
+	seen := map[string]bool{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".go" {
+			return nil
+		}
+
+		// nolint: gosec
+		blob, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, ref := range fileMocks(path, string(blob)) {
+			// A mock that is split across several files is only updated once.
+			key := filepath.Dir(ref.file) + " " + ref.importPath + " " + ref.pkgName + "." + ref.iface
+			if !seen[key] {
+				seen[key] = true
+				refs = append(refs, ref)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search mocks: %w", err)
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].file < refs[j].file
+	})
+	return refs, nil
+}
+
+// fileMocks returns the mocks declared in the content of the given file. Only the doc comments of type
+// declarations are considered, so the markers in other comments or string literals are ignored. The legacy
+// doc comment is only used if the file does not contain any directive.
+func fileMocks(path, content string) []*mockReference {
+	docs := typeDocs(path, content)
+
+	refs := []*mockReference{}
+	for _, directive := range parseDirectives(docs) {
+		importPath, iface, ok := splitQualifiedName(directive.Interface)
+		if !ok {
+			continue
+		}
+		refs = append(refs, &mockReference{file: path, importPath: importPath, iface: iface})
+	}
+	if len(refs) > 0 {
+		return refs
+	}
+
+	for _, match := range legacyMarkerRegex.FindAllStringSubmatch(docs, -1) {
+		refs = append(refs, &mockReference{file: path, pkgName: match[1], iface: match[2]})
+	}
+	return refs
+}
+
+// typeDocs returns the doc comments of all type declarations in the file, one comment per line. Files
+// that can not be parsed do not contain any mocks.
+func typeDocs(path, content string) string {
+	file, err := parser.ParseFile(token.NewFileSet(), path, content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return ""
+	}
+
+	lines := []string{}
+	add := func(doc *ast.CommentGroup) {
+		if doc == nil {
+			return
+		}
+		// CommentGroup.Text drops directives like //mockgen:interface, so the raw comments are used.
+		for _, comment := range doc.List {
+			lines = append(lines, comment.Text)
+		}
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		add(gen.Doc)
+		for _, spec := range gen.Specs {
+			add(spec.(*ast.TypeSpec).Doc)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resolve finds the interface the mock implements and the directory of its package. By convention the interface
+// is declared in the parent folder of the mock folder, otherwise the import path of the directive is loaded.
+func (r *mockReference) resolve() (*Interface, string, error) {
+	parent := filepath.Dir(filepath.Dir(r.file))
+	pkg, err := loadPackage(parent)
+	if err == nil && pkg.Types != nil && (pkg.PkgPath == r.importPath || (r.importPath == "" && pkg.Name == r.pkgName)) {
+		iface, err := newInterface(pkg.Types, r.iface, "")
+		return iface, parent, err
+	}
+	if r.importPath == "" {
+		return nil, "", fmt.Errorf("package %s is not the parent of the mock folder, add a %s directive to the mock", r.pkgName, directivePrefix)
+	}
+
+	pkg, err = loadImportPath(r.importPath, filepath.Dir(r.file))
+	if err != nil {
+		return nil, "", err
+	}
+	iface, err := newInterface(pkg.Types, r.iface, "")
+	if err != nil {
+		return nil, "", err
+	}
+	dir := localMocksDir
+	if len(pkg.GoFiles) > 0 {
+		dir = relativePath(filepath.Dir(pkg.GoFiles[0]))
+	}
+	return iface, dir, nil
+}
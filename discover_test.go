@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindMocks(t *testing.T) {
+	cleanup(t)
+	err := copy.Copy("./test/expectedfix", "./test/inputfix/example/examplemock")
+	require.NoError(t, err, "error in test setup")
+	defer cleanup(t)
+
+	refs, err := findMocks("./test/inputfix")
+	require.NoError(t, err)
+	require.Len(t, refs, 2)
+	assert.Equal(t, &mockReference{
+		file:       "test/inputfix/example/examplemock/result.go",
+		importPath: "github.com/fastbill/go-mock-gen/test/inputfix/example",
+		iface:      "Exampler",
+	}, refs[0])
+	assert.Equal(t, &mockReference{file: "test/inputfix/existing/testmock.go", pkgName: "example", iface: "Exampler"}, refs[1])
+
+	iface, dir, err := refs[0].resolve()
+	require.NoError(t, err)
+	assert.Equal(t, "test/inputfix/example", dir)
+	assert.Equal(t, "github.com/fastbill/go-mock-gen/test/inputfix/example.Exampler", interfaceID(iface))
+
+	// The existing folder is not part of the example package, so the package can not be found without directive.
+	_, _, err = refs[1].resolve()
+	assert.EqualError(t, err, "package example is not the parent of the mock folder, add a //mockgen:interface directive to the mock")
+}
+
+func TestUpdateAllMocks(t *testing.T) {
+	cleanup(t)
+	err := copy.Copy("./test/inputfix/existing", "./test/inputfix/example/examplemock")
+	require.NoError(t, err, "error in test setup")
+
+	code, stdout, stderr := runCLI("update", "./test/inputfix/example/...")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, "Updating 1 mocks...\n")
+	assert.Contains(t, stdout, "removed:     FunctionA")
+	assert.Contains(t, stdout, "Success! 1 of 1 mocks changed.\n")
+
+	expected, err := ioutil.ReadFile("./test/expectedfix/result.go")
+	require.NoError(t, err, "error in test setup")
+	actual, err := ioutil.ReadFile("./test/inputfix/example/examplemock/testmock.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+
+	code, _, stderr = runCLI("update", "./test/inputnew/model/...")
+	assert.Equal(t, exitFailure, code)
+	assert.Equal(t, "Error: no mocks found in ./test/inputnew/model/...\n", stderr)
+}
+
+func TestFileMocks(t *testing.T) {
+	content := `package examplemock
+
+// legacyMarkerRegex matches e.g. "TestMock is a mock implementation of the example.Exampler interface."
+var legacyMarkerRegex = "is a mock implementation of the example.Exampler interface"
+
+const directive = ` + "`" + `
+//mockgen:interface github.com/some-path/example.Example struct=ExampleMock
+` + "`" + `
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct{}
+
+type (
+	// OtherMock is a mock implementation of the example.Other interface.
+	//
+	//mockgen:interface github.com/some-path/example.Cache[string, int] struct=OtherMock
+	OtherMock struct{}
+)
+`
+
+	assert.Equal(t, []*mockReference{
+		{file: "mock.go", importPath: "github.com/some-path/example", iface: "Cache[string, int]"},
+	}, fileMocks("mock.go", content))
+
+	withoutDirective := strings.Replace(content, "\t//mockgen:interface github.com/some-path/example.Cache[string, int] struct=OtherMock\n", "", 1)
+	assert.Equal(t, []*mockReference{
+		{file: "mock.go", pkgName: "example", iface: "Exampler"},
+		{file: "mock.go", pkgName: "example", iface: "Other"},
+	}, fileMocks("mock.go", withoutDirective))
+
+	assert.Empty(t, fileMocks("broken.go", "// TestMock is a mock implementation of the example.Exampler interface.\ntype"))
+}
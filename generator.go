@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
 	"golang.org/x/tools/imports"
@@ -41,6 +42,7 @@ type Interface struct {
 	File            *ast.File
 	Pkg             *types.Package
 	NamedType       *types.Named
+	TypeArgs        string           // Type arguments if a generic type is mocked for them, e.g. [string, *model.Session].
 	IsFunction      bool             // If true, this instance represents a function, otherwise it's an interface.
 	ActualInterface *types.Interface // Holds the actual interface type, in case it's an interface.
 	SingleFunction  *Method          // Holds the function type information, in case it's a function type.
@@ -57,9 +59,14 @@ type Method struct {
 type Generator struct {
 	buf bytes.Buffer
 
-	iface      *Interface
-	pkg        string
-	structName string
+	iface        *Interface
+	pkg          string
+	localPkg     string // Import path of the package the mock is part of, empty for separate mock packages.
+	structName   string
+	receiverName string
+	err          error // First type that can not be rendered.
+
+	resolveAliases bool // Render aliases as the types they stand for instead of by their name.
 
 	localizationCache map[string]string
 	packagePathToName map[string]string
@@ -68,8 +75,8 @@ type Generator struct {
 	packageRoots []string
 }
 
-// NewGenerator builds a Generator.
-func NewGenerator(iface *Interface, structName string) *Generator {
+// NewGenerator builds a Generator. The receiverName is used as name of the receiver variable in all mock methods.
+func NewGenerator(iface *Interface, structName, receiverName string) *Generator {
 
 	var roots []string
 
@@ -81,6 +88,7 @@ func NewGenerator(iface *Interface, structName string) *Generator {
 		iface:             iface,
 		pkg:               iface.Pkg.Path(),
 		structName:        structName,
+		receiverName:      receiverName,
 		localizationCache: make(map[string]string),
 		packagePathToName: make(map[string]string),
 		nameToPackagePath: make(map[string]string),
@@ -91,11 +99,11 @@ func NewGenerator(iface *Interface, structName string) *Generator {
 	return g
 }
 func (g *Generator) populateImports(ctx context.Context) {
+	g.renderTypeParams(ctx)
 	for _, method := range g.iface.Methods() {
 		ftype := method.Signature
 		g.addImportsFromTuple(ctx, ftype.Params())
 		g.addImportsFromTuple(ctx, ftype.Results())
-		g.renderType(ctx, g.iface.NamedType)
 	}
 }
 
@@ -236,10 +244,10 @@ func (g *Generator) generateImports(ctx context.Context) {
 	g.printf(")")
 }
 
-// GeneratePrologue generates the prologue of the mock.
+// GeneratePrologue generates the prologue of the mock in the package with the given name.
 func (g *Generator) GeneratePrologue(ctx context.Context, pkg string) {
 	g.populateImports(ctx)
-	g.printf("package %v%s\n\n", pkg, "mock")
+	g.printf("package %s\n\n", pkg)
 
 	g.generateImports(ctx)
 	g.printf("\n")
@@ -257,11 +265,9 @@ type namer interface {
 func (g *Generator) renderType(ctx context.Context, typ types.Type) string {
 	switch t := typ.(type) {
 	case *types.Named:
-		o := t.Obj()
-		if o.Pkg() == nil || o.Pkg().Name() == "main" {
-			return o.Name()
-		}
-		return g.addPackageImport(ctx, o.Pkg()) + "." + o.Name()
+		return g.renderNamed(ctx, t.Obj()) + g.renderTypeArgs(ctx, t.TypeArgs())
+	case *types.Alias:
+		return g.renderAlias(ctx, t)
 	case *types.Basic:
 		return t.Name()
 	case *types.Pointer:
@@ -271,25 +277,7 @@ func (g *Generator) renderType(ctx context.Context, typ types.Type) string {
 	case *types.Array:
 		return fmt.Sprintf("[%d]%s", t.Len(), g.renderType(ctx, t.Elem()))
 	case *types.Signature:
-		switch t.Results().Len() {
-		case 0:
-			return fmt.Sprintf(
-				"func(%s)",
-				g.renderTypeTuple(ctx, t.Params()),
-			)
-		case 1:
-			return fmt.Sprintf(
-				"func(%s) %s",
-				g.renderTypeTuple(ctx, t.Params()),
-				g.renderType(ctx, t.Results().At(0).Type()),
-			)
-		default:
-			return fmt.Sprintf(
-				"func(%s)(%s)",
-				g.renderTypeTuple(ctx, t.Params()),
-				g.renderTypeTuple(ctx, t.Results()),
-			)
-		}
+		return "func" + g.renderSignature(ctx, t)
 	case *types.Map:
 		kt := g.renderType(ctx, t.Key())
 		vt := g.renderType(ctx, t.Elem())
@@ -305,42 +293,206 @@ func (g *Generator) renderType(ctx context.Context, typ types.Type) string {
 			return "chan<- " + g.renderType(ctx, t.Elem())
 		}
 	case *types.Struct:
-		var fields []string
-
-		for i := 0; i < t.NumFields(); i++ {
-			f := t.Field(i)
+		return g.renderStruct(ctx, t)
+	case *types.Interface:
+		// Constraints like ~int | ~string are implicit interfaces that embed the union.
+		if t.IsImplicit() && t.NumEmbeddeds() == 1 {
+			return g.renderType(ctx, t.EmbeddedType(0))
+		}
 
-			if f.Anonymous() {
-				fields = append(fields, g.renderType(ctx, f.Type()))
-			} else {
-				fields = append(fields, fmt.Sprintf("%s %s", f.Name(), g.renderType(ctx, f.Type())))
+		return g.renderInterface(ctx, t)
+	case *types.Union:
+		terms := make([]string, 0, t.Len())
+		for i := 0; i < t.Len(); i++ {
+			term := g.renderType(ctx, t.Term(i).Type())
+			if t.Term(i).Tilde() {
+				term = "~" + term
 			}
+			terms = append(terms, term)
 		}
+		return strings.Join(terms, " | ")
+	case *types.TypeParam:
+		return t.Obj().Name()
+	case namer:
+		return t.Name()
+	default:
+		g.fail(fmt.Errorf("unable to render the type %s", t))
+		return ""
+	}
+}
 
-		return fmt.Sprintf("struct{%s}", strings.Join(fields, ";"))
-	case *types.Interface:
-		if t.NumMethods() != 0 {
-			panic("Unable to mock inline interfaces with methods")
+// fail records the first error that occurs while rendering the mock. It is returned by Generate.
+func (g *Generator) fail(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+// renderSignature returns the parameters and results of a function type or method without the func keyword,
+// e.g. (ctx context.Context, ids ...string) (int, error). Names of parameters and results are kept.
+func (g *Generator) renderSignature(ctx context.Context, sig *types.Signature) string {
+	params := g.renderTypeTuple(ctx, sig.Params(), sig.Variadic())
+	results := sig.Results()
+	switch {
+	case results.Len() == 0:
+		return "(" + params + ")"
+	case results.Len() == 1 && results.At(0).Name() == "":
+		return "(" + params + ") " + g.renderType(ctx, results.At(0).Type())
+	default:
+		return "(" + params + ") (" + g.renderTypeTuple(ctx, results, false) + ")"
+	}
+}
+
+// renderStruct returns an anonymous struct type with the names, embedded types and tags of its fields.
+func (g *Generator) renderStruct(ctx context.Context, t *types.Struct) string {
+	if t.NumFields() == 0 {
+		return "struct{}"
+	}
+
+	var fields []string
+	for i := 0; i < t.NumFields(); i++ {
+		f := t.Field(i)
+		g.checkVisible(f, "field")
+
+		field := g.renderType(ctx, f.Type())
+		if !f.Embedded() {
+			field = f.Name() + " " + field
 		}
+		if tag := t.Tag(i); tag != "" {
+			field += " " + quoteTag(tag)
+		}
+		fields = append(fields, field)
+	}
+	return "struct {\n" + strings.Join(fields, "\n") + "\n}"
+}
 
+// renderInterface returns an interface literal with its methods and embedded types.
+func (g *Generator) renderInterface(ctx context.Context, t *types.Interface) string {
+	if t.NumExplicitMethods() == 0 && t.NumEmbeddeds() == 0 {
 		return "interface{}"
-	case namer:
-		return t.Name()
-	default:
-		panic(fmt.Sprintf("un-namable type: %#v (%T)", t, t))
 	}
+
+	var elems []string
+	for i := 0; i < t.NumEmbeddeds(); i++ {
+		elems = append(elems, g.renderType(ctx, t.EmbeddedType(i)))
+	}
+	for i := 0; i < t.NumExplicitMethods(); i++ {
+		m := t.ExplicitMethod(i)
+		g.checkVisible(m, "method")
+		elems = append(elems, m.Name()+g.renderSignature(ctx, m.Type().(*types.Signature)))
+	}
+	return "interface {\n" + strings.Join(elems, "\n") + "\n}"
 }
 
-func (g *Generator) renderTypeTuple(ctx context.Context, tup *types.Tuple) string {
+// checkVisible fails if the unexported field or method of an anonymous type belongs to another package. The
+// mock could not declare the same type then, because unexported names of different packages are distinct.
+func (g *Generator) checkVisible(obj types.Object, kind string) {
+	if obj.Exported() || obj.Pkg() == nil || obj.Pkg().Path() == g.localPkg {
+		return
+	}
+	g.fail(fmt.Errorf("the unexported %s %s of an anonymous type in %s can only be used in its own package, generate the mock in the package of the interface", kind, obj.Name(), obj.Pkg().Path()))
+}
+
+// quoteTag returns the struct tag as a raw string literal, or as an interpreted one if it contains a backquote.
+func quoteTag(tag string) string {
+	if strings.ContainsRune(tag, '`') {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+// renderNamed returns the name of the type, qualified with the name of its package unless it is declared in
+// the package of the mock.
+func (g *Generator) renderNamed(ctx context.Context, o *types.TypeName) string {
+	if o.Pkg() == nil || o.Pkg().Path() == g.localPkg {
+		return o.Name()
+	}
+	if o.Pkg().Name() == "main" || !o.Exported() {
+		g.fail(fmt.Errorf("%s.%s can only be used in its own package, generate the mock in the package of the interface", o.Pkg().Path(), o.Name()))
+		return o.Name()
+	}
+	return g.addPackageImport(ctx, o.Pkg()) + "." + o.Name()
+}
+
+// renderAlias returns the name of the alias as it is declared, e.g. ids.UserID. Aliases that can not be used by
+// the mock, like unexported ones of other packages, are rendered as the type they stand for. Predeclared aliases
+// like any are always kept.
+func (g *Generator) renderAlias(ctx context.Context, t *types.Alias) string {
+	o := t.Obj()
+	if o.Pkg() == nil {
+		return o.Name()
+	}
+	visible := o.Pkg().Path() == g.localPkg || (o.Exported() && o.Pkg().Name() != "main")
+	if g.resolveAliases || !visible {
+		return g.renderType(ctx, types.Unalias(t))
+	}
+
+	return g.renderNamed(ctx, o) + g.renderTypeArgs(ctx, t.TypeArgs())
+}
+
+// renderTypeArgs returns the type arguments of an instantiated generic type, e.g. [model.User], or an empty
+// string if there are none.
+func (g *Generator) renderTypeArgs(ctx context.Context, args *types.TypeList) string {
+	if args.Len() == 0 {
+		return ""
+	}
+
+	rendered := make([]string, 0, args.Len())
+	for i := 0; i < args.Len(); i++ {
+		rendered = append(rendered, g.renderType(ctx, args.At(i)))
+	}
+	return "[" + strings.Join(rendered, ", ") + "]"
+}
+
+// renderTypeParams returns the type parameter list of a generic interface as it is declared, e.g. [K comparable, V any],
+// and as it is used in the receivers of the methods, e.g. [K, V]. Both are empty for other interfaces.
+func (g *Generator) renderTypeParams(ctx context.Context) (string, string) {
+	params := g.iface.NamedType.TypeParams()
+	if params.Len() == 0 || g.iface.NamedType.TypeArgs().Len() > 0 {
+		return "", ""
+	}
+
+	decls := make([]string, 0, params.Len())
+	names := make([]string, 0, params.Len())
+	for i := 0; i < params.Len(); i++ {
+		param := params.At(i)
+		constraint := "any"
+		if iface, ok := types.Unalias(param.Constraint()).(*types.Interface); !ok || !iface.Empty() {
+			constraint = g.renderType(ctx, param.Constraint())
+		}
+		decls = append(decls, param.Obj().Name()+" "+constraint)
+		names = append(names, param.Obj().Name())
+	}
+	return "[" + strings.Join(decls, ", ") + "]", "[" + strings.Join(names, ", ") + "]"
+}
+
+// renderTypeTuple returns the parameters or results of a function type, with their names if they have any.
+func (g *Generator) renderTypeTuple(ctx context.Context, tup *types.Tuple, variadic bool) string {
 	var parts []string
 
 	for i := 0; i < tup.Len(); i++ {
 		v := tup.At(i)
 
-		parts = append(parts, g.renderType(ctx, v.Type()))
+		part := g.renderType(ctx, v.Type())
+		if variadic && i == tup.Len()-1 {
+			part = g.renderVariadic(ctx, v)
+		}
+		if v.Name() != "" {
+			part = v.Name() + " " + part
+		}
+		parts = append(parts, part)
 	}
 
-	return strings.Join(parts, " , ")
+	return strings.Join(parts, ", ")
+}
+
+// renderVariadic returns the type of the variadic parameter, e.g. ...string for a []string.
+func (g *Generator) renderVariadic(ctx context.Context, v *types.Var) string {
+	if t, ok := v.Type().(*types.Slice); ok {
+		return "..." + g.renderType(ctx, t.Elem())
+	}
+	g.fail(fmt.Errorf("the variadic parameter %s has the unexpected type %s", v.Name(), v.Type()))
+	return ""
 }
 
 func isNillable(typ types.Type) bool {
@@ -349,15 +501,31 @@ func isNillable(typ types.Type) bool {
 		return true
 	case *types.Named:
 		return isNillable(t.Underlying())
+	case *types.Alias:
+		return isNillable(types.Unalias(t))
 	}
 	return false
 }
 
+func isTypeParam(typ types.Type) bool {
+	_, ok := typ.(*types.TypeParam)
+	return ok
+}
+
+// zeroValue returns the expression that is returned for a nil result of the given type.
+func zeroValue(typ types.Type, rendered string) string {
+	if isTypeParam(typ) {
+		return "*new(" + rendered + ")"
+	}
+	return "nil"
+}
+
 type paramList struct {
 	Names    []string
 	Types    []string
 	Params   []string
 	Nilable  []bool
+	Zero     []string // Value that is returned if the mock returns nil, e.g. nil or *new(T) for type parameters.
 	Variadic bool
 }
 
@@ -374,14 +542,8 @@ func (g *Generator) genList(ctx context.Context, list *types.Tuple, variadic boo
 		ts := g.renderType(ctx, v.Type())
 
 		if variadic && i == list.Len()-1 {
-			t := v.Type()
-			switch t := t.(type) {
-			case *types.Slice:
-				params.Variadic = true
-				ts = "..." + g.renderType(ctx, t.Elem())
-			default:
-				panic("bad variadic type!")
-			}
+			params.Variadic = true
+			ts = g.renderVariadic(ctx, v)
 		}
 
 		pname := v.Name()
@@ -394,14 +556,15 @@ func (g *Generator) genList(ctx context.Context, list *types.Tuple, variadic boo
 		params.Types = append(params.Types, ts)
 
 		params.Params = append(params.Params, fmt.Sprintf("%s %s", pname, ts))
-		params.Nilable = append(params.Nilable, isNillable(v.Type()))
+		params.Nilable = append(params.Nilable, isNillable(v.Type()) || isTypeParam(v.Type()))
+		params.Zero = append(params.Zero, zeroValue(v.Type(), ts))
 	}
 
 	return &params
 }
 
 func (g *Generator) nameCollides(pname string) bool {
-	if pname == g.pkg {
+	if pname == g.pkg || pname == g.receiverName {
 		return true
 	}
 	return g.importNameExists(pname)
@@ -418,14 +581,22 @@ func (g *Generator) Generate(ctx context.Context) error {
 	if g.iface == nil {
 		return ErrNotSetup
 	}
+	if g.importNameExists(g.receiverName) {
+		g.fail(fmt.Errorf("the receiver name %s is also the name of an imported package", g.receiverName))
+	}
+	if g.err != nil {
+		return g.err
+	}
 
 	g.printf(
 		"// %s is a mock implementation of the %s interface.\n", g.mockName(),
-		g.iface.Pkg.Name()+"."+g.iface.Name,
+		g.iface.Pkg.Name()+"."+g.iface.Name+g.iface.TypeArgs,
 	)
+	g.printf("//\n%s\n", interfaceDirective(g.iface, g.mockName()))
 
+	typeParams, typeArgs := g.renderTypeParams(ctx)
 	g.printf(
-		"type %s struct {\n\tmock.Mock\n}\n\n", g.mockName(),
+		"type %s%s struct {\n\tmock.Mock\n}\n\n", g.mockName(), typeParams,
 	)
 
 	for _, method := range g.iface.Methods() {
@@ -438,7 +609,7 @@ func (g *Generator) Generate(ctx context.Context) error {
 
 		g.printf("// %s is a mock implementation of %s.%s#%s.\n", fname, g.iface.Pkg.Name(), g.iface.Name, fname)
 		g.printf(
-			"func (m *%s) %s(%s) ", g.mockName(), fname,
+			"func (%s *%s%s) %s(%s) ", g.receiverName, g.mockName(), typeArgs, fname,
 			strings.Join(params.Params, ", "),
 		)
 
@@ -497,7 +668,7 @@ func (g *Generator) Generate(ctx context.Context) error {
 		g.printf("}\n")
 	}
 
-	return nil
+	return g.err
 }
 
 // generateCalled returns the Mock.Called invocation string and, if necessary, prints the
@@ -507,11 +678,11 @@ func (g *Generator) Generate(ctx context.Context) error {
 func (g *Generator) generateCalled(list *paramList, formattedParamNames string) string {
 	namesLen := len(list.Names)
 	if namesLen == 0 {
-		return "m.Called()"
+		return g.receiverName + ".Called()"
 	}
 
 	if !list.Variadic {
-		return "m.Called(" + formattedParamNames + ")"
+		return g.receiverName + ".Called(" + formattedParamNames + ")"
 	}
 
 	var variadicArgsName string
@@ -557,7 +728,7 @@ func (g *Generator) generateCalled(list *paramList, formattedParamNames string)
 	}
 	g.printf("\t_ca = append(_ca, %s...)\n", variadicArgsName)
 
-	return "m.Called(_ca...)"
+	return g.receiverName + ".Called(_ca...)"
 }
 
 func (g *Generator) Write(w io.Writer) error {
@@ -589,7 +760,7 @@ func representation(returns *paramList, withoutNilable bool) string {
 			r = fmt.Sprintf("args.%s(%d)", representationMap[typ], idx)
 		} else {
 			if withoutNilable {
-				r = "nil"
+				r = returns.Zero[idx]
 			} else {
 				r = fmt.Sprintf("args.Get(%d).(%s)", idx, typ)
 			}
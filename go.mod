@@ -1,21 +1,20 @@
 module github.com/fastbill/go-mock-gen
 
-go 1.18
+go 1.23.0
 
 require (
 	github.com/fastbill/go-httperrors/v2 v2.0.2
 	github.com/otiai10/copy v1.7.0
 	github.com/pkg/errors v0.9.1
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.7.1
-	golang.org/x/tools v0.1.10
+	golang.org/x/tools v0.30.0
+	gopkg.in/yaml.v3 v3.0.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.4.0 // indirect
-	golang.org/x/mod v0.6.0-dev.0.20220106191415-9b9b3d81d5e3 // indirect
-	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
-	golang.org/x/xerrors v0.0.0-20220517211312-f3a8303e98df // indirect
-	gopkg.in/yaml.v3 v3.0.0 // indirect
+	golang.org/x/mod v0.23.0 // indirect
+	golang.org/x/sync v0.11.0 // indirect
 )
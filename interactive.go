@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Everything after this line in the file opened in the editor is ignored.
+const editMarker = "// ----- go-mock-gen: everything below this line is ignored -----"
+
+// methodConflict is a customized method whose signature changed in the interface.
+type methodConflict struct {
+	name       string
+	existing   string // Source code of the existing method.
+	generated  string // Source code of the newly generated method.
+	rewritten  string // Existing method adapted to the new signature, empty if that was not possible.
+	rewriteErr error  // Reason why the existing method could not be rewritten.
+}
+
+// conflictResolver decides how a customized method whose signature changed is updated.
+// It returns the source code of the method that should end up in the mock.
+type conflictResolver interface {
+	resolve(conflict *methodConflict) (string, error)
+}
+
+// resolveConflict lets the resolver choose the new implementation of a method whose signature changed.
+// Methods that were not customized are regenerated without asking.
+func (mg *merger) resolveConflict(existingFn, newFn *ast.FuncDecl) error {
+	existing, err := mg.existing.print(existingFn)
+	if err != nil {
+		return err
+	}
+	generated, err := mg.generated.print(newFn)
+	if err != nil {
+		return err
+	}
+
+	conflict := &methodConflict{name: newFn.Name.Name, existing: existing, generated: generated}
+	conflict.rewritten, conflict.rewriteErr = rewriteMethod(mg.existing, existingFn, mg.generated, newFn)
+	// If adapting the old method mechanically leads to the generated one there is nothing to keep.
+	if conflict.rewritten == generated {
+		return nil
+	}
+
+	code, err := mg.opts.resolver.resolve(conflict)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve changed signature of "+conflict.name)
+	}
+	if code == existing {
+		mg.warnings = append(mg.warnings, fmt.Sprintf("%s was kept with its old signature and must be fixed by hand", conflict.name))
+	}
+	if code != generated {
+		mg.chosen[conflict.name] = mockMethod{source: mg.existing, decl: existingFn, code: code}
+	}
+	return nil
+}
+
+// prompter resolves conflicts by asking the user. It shows the existing and the generated method and lets
+// the user keep the existing body, regenerate the method or edit it in an editor.
+type prompter struct {
+	in     *bufio.Reader
+	out    io.Writer
+	editor string
+}
+
+// newPrompter creates a prompter that uses the editor set in $EDITOR, vi by default.
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	return &prompter{in: bufio.NewReader(in), out: out, editor: editor}
+}
+
+func (p *prompter) resolve(conflict *methodConflict) (string, error) {
+	diff, err := unifiedDiff("existing", "generated", conflict.existing, conflict.generated)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(p.out, "\nThe signature of %s changed.\n\n", conflict.name)
+	fmt.Fprintf(p.out, "--- Existing method ---\n%s\n\n", conflict.existing)
+	fmt.Fprintf(p.out, "--- Generated method ---\n%s\n\n", conflict.generated)
+	fmt.Fprintf(p.out, "--- Diff ---\n%s\n", diff)
+	if conflict.rewritten == "" {
+		fmt.Fprintf(p.out, "The existing body can not be adapted to the new signature: %s\n", conflict.rewriteErr)
+		fmt.Fprintln(p.out, "Keeping it leaves the old signature in place.")
+	}
+
+	for {
+		fmt.Fprintf(p.out, "[k]eep existing body, [r]egenerate or [e]dit in %s? ", p.editor)
+		line, err := p.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", errors.Wrap(err, "failed to read answer")
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "k", "keep":
+			if conflict.rewritten != "" {
+				return conflict.rewritten, nil
+			}
+			return conflict.existing, nil
+		case "r", "regenerate":
+			return conflict.generated, nil
+		case "e", "edit":
+			code, err := p.edit(conflict)
+			if err != nil {
+				fmt.Fprintf(p.out, "Editing failed: %s\n", err)
+				continue
+			}
+			return code, nil
+		}
+	}
+}
+
+// edit opens the proposed method in the editor. The existing method is appended as a comment for reference.
+func (p *prompter) edit(conflict *methodConflict) (string, error) {
+	proposal := conflict.rewritten
+	if proposal == "" {
+		proposal = conflict.generated
+	}
+
+	f, err := ioutil.TempFile("", "go-mock-gen-*.go")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create temporary file")
+	}
+	defer os.Remove(f.Name()) //nolint: errcheck
+
+	reference := "// " + strings.ReplaceAll(conflict.existing, "\n", "\n// ")
+	_, err = fmt.Fprintf(f, "%s\n\n%s\n// Existing method:\n%s\n", proposal, editMarker, reference)
+	close(f)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to write temporary file")
+	}
+
+	fields := strings.Fields(p.editor)
+	cmd := exec.Command(fields[0], append(fields[1:], f.Name())...) //nolint: gosec
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return "", errors.Wrap(err, "editor failed")
+	}
+
+	// nolint: gosec
+	blob, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read edited file")
+	}
+	code := string(blob)
+	if i := strings.Index(code, editMarker); i >= 0 {
+		code = code[:i]
+	}
+	code = strings.TrimSpace(code)
+
+	return code, checkMethod(conflict.name, code)
+}
+
+// checkMethod verifies that the code is exactly one declaration of the method with the given name.
+func checkMethod(name, code string) error {
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package p\n\n"+code, parser.ParseComments)
+	if err != nil {
+		return errors.Wrap(err, "invalid method")
+	}
+	if len(file.Decls) != 1 {
+		return fmt.Errorf("expected exactly one declaration but found %d", len(file.Decls))
+	}
+	fn, ok := file.Decls[0].(*ast.FuncDecl)
+	if !ok || fn.Recv == nil || fn.Name.Name != name {
+		return fmt.Errorf("expected the method %s", name)
+	}
+	return nil
+}
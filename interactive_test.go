@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const interactiveExisting = rewritePreambleWithoutModel + `
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	args := m.Called(id)
+
+	return "custom", args.Error(1)
+}
+
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id int) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+`
+
+const interactiveGenerated = rewritePreambleWithoutModel + `
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int, force bool) (string, error) {
+	args := m.Called(id, force)
+
+	return args.String(0), args.Error(1)
+}
+
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id int, force bool) error {
+	args := m.Called(id, force)
+
+	return args.Error(0)
+}
+`
+
+const interactiveDelete = `
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id int, force bool) error {
+	args := m.Called(id, force)
+
+	return args.Error(0)
+}
+`
+
+func TestInteractiveUpdate(t *testing.T) {
+	tests := map[string]struct {
+		answers  string
+		editor   string
+		expected string
+		warnings []string
+	}{
+		"keep": {
+			answers: "x\nk\n",
+			expected: `
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int, force bool) (string, error) {
+	args := m.Called(id, force)
+
+	return "custom", args.Error(1)
+}
+`,
+		},
+		"regenerate": {
+			answers: "r\n",
+			expected: `
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int, force bool) (string, error) {
+	args := m.Called(id, force)
+
+	return args.String(0), args.Error(1)
+}
+`,
+		},
+		"edit": {
+			answers: "e\n",
+			editor:  "#!/bin/sh\nsed -i 's/\"custom\"/\"edited\"/' \"$1\"\n",
+			expected: `
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int, force bool) (string, error) {
+	args := m.Called(id, force)
+
+	return "edited", args.Error(1)
+}
+`,
+		},
+		"broken edit": {
+			answers: "e\nr\n",
+			editor:  "#!/bin/sh\necho 'func (m *TestMock) Get(' > \"$1\"\n",
+			expected: `
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int, force bool) (string, error) {
+	args := m.Called(id, force)
+
+	return args.String(0), args.Error(1)
+}
+`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			p := newPrompter(strings.NewReader(test.answers), out)
+			if test.editor != "" {
+				p.editor = filepath.Join(t.TempDir(), "editor.sh")
+				require.NoError(t, ioutil.WriteFile(p.editor, []byte(test.editor), 0700))
+			}
+
+			existing, err := parseMock("existing.go", interactiveExisting)
+			require.NoError(t, err)
+			result, err := calcResultMock(existing, interactiveGenerated, "TestMock", packageImporter{}, updateOptions{resolver: p})
+			require.NoError(t, err)
+
+			assert.Equal(t, rewritePreambleWithoutModel+test.expected+interactiveDelete, result.source)
+			assert.Equal(t, test.warnings, result.warnings)
+			// Only Get was customized, Delete is regenerated without asking.
+			assert.Equal(t, 1, strings.Count(out.String(), "--- Diff ---"))
+			assert.Contains(t, out.String(), "+\treturn args.String(0), args.Error(1)")
+		})
+	}
+}
+
+func TestInteractiveUpdateKeepsUnrewritableMethod(t *testing.T) {
+	existing, err := parseMock("existing.go", rewritePreambleWithoutModel+`
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id int) error {
+	if id == 0 {
+		return nil
+	}
+	return m.Called(id).Error(0)
+}
+`)
+	require.NoError(t, err)
+	newMock := rewritePreambleWithoutModel + `
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id string) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+`
+
+	out := &bytes.Buffer{}
+	result, err := calcResultMock(existing, newMock, "TestMock", packageImporter{}, updateOptions{resolver: newPrompter(strings.NewReader("k\n"), out)})
+	require.NoError(t, err)
+	assert.Equal(t, string(existing.src), result.source)
+	assert.Equal(t, []string{"Delete was kept with its old signature and must be fixed by hand"}, result.warnings)
+	assert.Contains(t, out.String(), "The existing body can not be adapted to the new signature")
+
+	_, err = calcResultMock(existing, newMock, "TestMock", packageImporter{}, updateOptions{resolver: newPrompter(strings.NewReader(""), out)})
+	assert.EqualError(t, err, "failed to resolve changed signature of Delete: failed to read answer: EOF")
+}
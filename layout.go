@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Default templates of the mock layout, e.g. pkg/repository/repositorymock/repository.go for the mock struct
+// Repository of pkg/repository.Persister.
+const (
+	defaultOutputTemplate  = "{{.Dir}}/{{.Package}}mock"
+	defaultPackageTemplate = "{{.Package}}mock"
+	defaultFileTemplate    = "{{lower .Struct}}.go"
+)
+
+// layout defines where mocks are written and how their packages and files are named. Each part is a template
+// that is executed with layoutData, empty parts use the defaults.
+type layout struct {
+	output    string // Folder of the mock, relative to the working directory.
+	pkg       string // Name of the package of the mock.
+	file      string // Name of the file of a new mock.
+	inPackage bool   // The mock is part of the package of the interface, output and pkg are ignored then.
+	test      string // Generate the mock into a _test.go file of the package of the interface, see testInternal.
+}
+
+// Packages of mocks in _test.go files.
+const (
+	testInternal = "internal" // The package of the interface.
+	testExternal = "external" // The external test package of the interface, e.g. repository_test.
+)
+
+// layoutData is passed to the templates of the layout.
+type layoutData struct {
+	Dir       string // Directory of the package of the interface, or the local mocks folder for other modules.
+	Package   string // Name of the package of the interface, e.g. repository.
+	Interface string // Name of the interface, e.g. Persister.
+	Struct    string // Name of the mock struct, e.g. Repository. Only set for file names.
+}
+
+var layoutFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"snake": snakeCase,
+}
+
+// validate executes all templates once, so mistakes are reported before anything is generated.
+func (l layout) validate() error {
+	if l.test != "" && l.test != testInternal && l.test != testExternal {
+		return fmt.Errorf("unknown test package %q", l.test)
+	}
+	if l.test != "" && l.inPackage {
+		return errors.New("a mock can either be in the package of the interface or in a test file")
+	}
+
+	data := layoutData{Dir: ".", Package: "example", Interface: "Exampler", Struct: "Example"}
+	for _, part := range []struct{ name, tmpl, def string }{
+		{"output", l.output, defaultOutputTemplate},
+		{"package", l.pkg, defaultPackageTemplate},
+		{"file", l.file, defaultFileTemplate},
+	} {
+		_, err := executeLayout(part.name, part.tmpl, part.def, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// folder returns the folder of the mock of the interface in the package in dir.
+func (l layout) folder(dir string, iface *Interface) (string, error) {
+	if l.packageDir() {
+		return filepath.Clean(dir), nil
+	}
+	folder, err := executeLayout("output", l.output, defaultOutputTemplate, newLayoutData(dir, iface))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Clean(folder), nil
+}
+
+// packageName returns the name of the package of a new mock.
+func (l layout) packageName(dir string, iface *Interface) (string, error) {
+	if l.test == testExternal {
+		return iface.Pkg.Name() + "_test", nil
+	}
+	if l.packageDir() {
+		return iface.Pkg.Name(), nil
+	}
+	name, err := executeLayout("package", l.pkg, defaultPackageTemplate, newLayoutData(dir, iface))
+	if err != nil {
+		return "", err
+	}
+	if !token.IsIdentifier(name) {
+		return "", fmt.Errorf("package template results in the invalid name %q", name)
+	}
+	return name, nil
+}
+
+// fileName returns the name of the file of a new mock.
+func (l layout) fileName(dir string, iface *Interface, structName string) (string, error) {
+	data := newLayoutData(dir, iface)
+	data.Struct = structName
+	name, err := executeLayout("file", l.file, defaultFileTemplate, data)
+	if err != nil {
+		return "", err
+	}
+	if filepath.Ext(name) != ".go" || strings.ContainsRune(name, filepath.Separator) {
+		return "", fmt.Errorf("file template results in the invalid file name %q", name)
+	}
+	if l.test != "" && !strings.HasSuffix(name, "_test.go") {
+		name = strings.TrimSuffix(name, ".go") + "_test.go"
+	}
+	return name, nil
+}
+
+// existingMock finds the existing mock of the interface in the package in dir. Mocks in the directory of the
+// interface are only searched in the directory itself and not in its subfolders.
+func (l layout) existingMock(dir string, iface *Interface) (*existingMock, error) {
+	folder, err := l.folder(dir, iface)
+	if err != nil {
+		return nil, err
+	}
+	return readExistingFiles(folder, iface, !l.packageDir())
+}
+
+// packageDir reports whether the mock is in the directory of the package of the interface.
+func (l layout) packageDir() bool {
+	return l.inPackage || l.test != ""
+}
+
+// local reports whether the mock is part of the package of the interface, so its types are not qualified.
+func (l layout) local() bool {
+	return l.inPackage || l.test == testInternal
+}
+
+// sameDir reports whether both paths point to the same directory.
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+func newLayoutData(dir string, iface *Interface) layoutData {
+	return layoutData{Dir: dir, Package: iface.Pkg.Name(), Interface: iface.Name}
+}
+
+func executeLayout(name, tmpl, def string, data layoutData) (string, error) {
+	if tmpl == "" {
+		tmpl = def
+	}
+
+	t, err := template.New(name).Funcs(layoutFuncs).Parse(tmpl)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid %s template", name)
+	}
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, data)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid %s template", name)
+	}
+	return buf.String(), nil
+}
+
+// snakeCase converts a Go name to snake case, e.g. HTTPClientMock to http_client_mock.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	out := []rune{}
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				out = append(out, '_')
+			}
+		}
+		out = append(out, unicode.ToLower(r))
+	}
+	return string(out)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"TestMock":       "test_mock",
+		"HTTPClientMock": "http_client_mock",
+		"Persister":      "persister",
+		"OAuth2Client":   "o_auth2_client",
+		"readCloser":     "read_closer",
+	}
+	for name, expected := range tests {
+		assert.Equal(t, expected, snakeCase(name))
+	}
+}
+
+func TestLayout(t *testing.T) {
+	iface, err := findInterface("./test/inputnew/example/types.go", "Exampler")
+	require.NoError(t, err)
+
+	folder, err := layout{}.folder("./test/inputnew/example", iface)
+	require.NoError(t, err)
+	assert.Equal(t, "test/inputnew/example/examplemock", folder)
+	pkg, err := layout{}.packageName("./test/inputnew/example", iface)
+	require.NoError(t, err)
+	assert.Equal(t, "examplemock", pkg)
+	file, err := layout{}.fileName("./test/inputnew/example", iface, "TestMock")
+	require.NoError(t, err)
+	assert.Equal(t, "testmock.go", file)
+
+	l := layout{output: "internal/mocks/{{.Package}}", pkg: "{{.Package}}mocks", file: "{{snake .Struct}}.go"}
+	require.NoError(t, l.validate())
+	folder, err = l.folder("./test/inputnew/example", iface)
+	require.NoError(t, err)
+	assert.Equal(t, "internal/mocks/example", folder)
+	pkg, err = l.packageName("./test/inputnew/example", iface)
+	require.NoError(t, err)
+	assert.Equal(t, "examplemocks", pkg)
+	file, err = l.fileName("./test/inputnew/example", iface, "TestMock")
+	require.NoError(t, err)
+	assert.Equal(t, "test_mock.go", file)
+
+	assert.EqualError(t, layout{pkg: "{{.Name}}"}.validate(), `invalid package template: template: package:1:2: executing "package" at <.Name>: can't evaluate field Name in type main.layoutData`)
+	_, err = layout{pkg: "{{.Package}}-mock"}.packageName("", iface)
+	assert.EqualError(t, err, `package template results in the invalid name "example-mock"`)
+	_, err = layout{file: "{{.Struct}}"}.fileName("", iface, "TestMock")
+	assert.EqualError(t, err, `file template results in the invalid file name "TestMock"`)
+}
+
+func TestCustomLayout(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "mocks")
+	outputTemplate := output + "/{{.Package}}"
+	path := filepath.Join(output, "example", "test_mock.go")
+
+	code, _, stderr := runCLI("new", "-output", outputTemplate, "-package", "{{.Package}}mocks", "-file", "{{snake .Struct}}.go",
+		"./test/inputnew/example/types.go", "Exampler", "TestMock")
+	require.Equal(t, exitOK, code, stderr)
+	actual, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(actual), "package examplemocks\n")
+
+	// Update finds the mock in the same location.
+	code, _, stderr = runCLI("check", "-output", outputTemplate, "./test/inputnew/example/types.go", "Exampler")
+	assert.Equal(t, exitOK, code, stderr)
+	code, stdout, stderr := runCLI("update", "-output", outputTemplate, "./test/inputnew/example/types.go", "Exampler")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, path+" (github.com/fastbill/go-mock-gen/test/inputnew/example.Exampler)\n")
+	code, _, _ = runCLI("check", "./test/inputnew/example/types.go", "Exampler")
+	assert.Equal(t, exitFailure, code)
+
+	code, _, stderr = runCLI("new", "-package", "{{.Name}}", "./test/inputnew/example/types.go", "Exampler", "TestMock")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "Error: invalid package template")
+}
+
+func TestInPackageMock(t *testing.T) {
+	path := "./test/inpackage/storemock.go"
+	defer os.Remove(path) //nolint: errcheck
+
+	code, _, stderr := runCLI("new", "./test/inpackage", "Storer", "StoreMock")
+	assert.Equal(t, exitFailure, code)
+	assert.Equal(t, "Error: failed to generate mock: github.com/fastbill/go-mock-gen/test/inpackage.record can only be used in its own package, generate the mock in the package of the interface\n", stderr)
+
+	code, _, stderr = runCLI("new", "-in-package", "./test/inpackage", "Storer", "StoreMock")
+	require.Equal(t, exitOK, code, stderr)
+	actual, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(actual), "package store\n")
+	assert.Contains(t, string(actual), "func (m *StoreMock) Find(r *record) ([]Item, error) {\n")
+
+	// The customized method is compared with the types of the package, so the renamed parameter is no change.
+	customized := strings.Replace(string(actual), "Get(id int)", "Get(key int)", 1)
+	customized = strings.Replace(customized, "m.Called(id)", "m.Called(key + 1)", 1)
+	require.NoError(t, ioutil.WriteFile(path, []byte(customized), 0644), "error in test setup")
+	code, _, stderr = runCLI("check", "-in-package", "./test/inpackage", "Storer")
+	assert.Equal(t, exitOK, code, stderr)
+	code, stdout, stderr := runCLI("update", "./test/inpackage/...")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Equal(t, "Updating 1 mocks...\nSuccess! 0 of 1 mocks changed.\n", stdout)
+}
+
+func TestUnexportedInterfaceMock(t *testing.T) {
+	defer os.RemoveAll("./test/inpackage/storemock") //nolint: errcheck
+
+	code, _, stderr := runCLI("new", "./test/inpackage", "itemCache", "ItemCacheMock")
+	require.Equal(t, exitOK, code, stderr)
+	actual, err := ioutil.ReadFile("./test/inpackage/storemock/itemcachemock.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(actual), "package storemock\n")
+	assert.Contains(t, string(actual), "func (m *ItemCacheMock) Get(id int) (*store.Item, error) {\n")
+}
+
+func TestTestFileLayout(t *testing.T) {
+	iface, err := findInterface("./test/inpackage", "Lister")
+	require.NoError(t, err)
+
+	for test, expectedPkg := range map[string]string{testInternal: "store", testExternal: "store_test"} {
+		l := layout{test: test}
+		require.NoError(t, l.validate())
+		folder, err := l.folder("./test/inpackage", iface)
+		require.NoError(t, err)
+		assert.Equal(t, "test/inpackage", folder)
+		pkg, err := l.packageName("./test/inpackage", iface)
+		require.NoError(t, err)
+		assert.Equal(t, expectedPkg, pkg)
+		file, err := l.fileName("./test/inpackage", iface, "ListerMock")
+		require.NoError(t, err)
+		assert.Equal(t, "listermock_test.go", file)
+		assert.Equal(t, test == testInternal, l.local())
+	}
+
+	assert.EqualError(t, layout{test: "unit"}.validate(), `unknown test package "unit"`)
+	assert.EqualError(t, layout{test: testInternal, inPackage: true}.validate(), "a mock can either be in the package of the interface or in a test file")
+}
+
+func TestTestFileMocks(t *testing.T) {
+	defer os.Remove("./test/inpackage/storemock_test.go")  //nolint: errcheck
+	defer os.Remove("./test/inpackage/listermock_test.go") //nolint: errcheck
+
+	code, _, stderr := runCLI("new", "-test", testInternal, "./test/inpackage", "Storer", "StoreMock")
+	require.Equal(t, exitOK, code, stderr)
+	code, _, stderr = runCLI("new", "-test", testExternal, "./test/inpackage", "Lister", "ListerMock")
+	require.Equal(t, exitOK, code, stderr)
+
+	actual, err := ioutil.ReadFile("./test/inpackage/storemock_test.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(actual), "package store\n")
+	assert.Contains(t, string(actual), "func (m *StoreMock) Find(r *record) ([]Item, error) {\n")
+	actual, err = ioutil.ReadFile("./test/inpackage/listermock_test.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(actual), "package store_test\n")
+	assert.Contains(t, string(actual), "\tstore \"github.com/fastbill/go-mock-gen/test/inpackage\"\n")
+	assert.Contains(t, string(actual), "func (m *ListerMock) List(prefix string) ([]*store.Item, error) {\n")
+
+	code, stdout, stderr := runCLI("update", "./test/inpackage/...")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Equal(t, "Updating 2 mocks...\nSuccess! 0 of 2 mocks changed.\n", stdout)
+
+	code, _, stderr = runCLI("new", "-test", testExternal, "./test/inpackage", "Storer", "ExternalStoreMock")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stderr, "inpackage.record can only be used in its own package")
+}
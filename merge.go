@@ -0,0 +1,632 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/imports"
+)
+
+// mockSource is a mock file that was parsed with go/parser so it can be merged on the AST level.
+type mockSource struct {
+	fset *token.FileSet
+	file *ast.File
+	src  []byte
+	name string
+	info *types.Info // Only set after typeCheck was called.
+
+	importer   types.Importer // The importer that typeCheck used.
+	typeErrors []types.Error  // The errors that typeCheck found.
+}
+
+func parseMock(filename string, src string) (*mockSource, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse "+filename)
+	}
+
+	return &mockSource{fset: fset, file: file, src: []byte(src), name: filename}, nil
+}
+
+// structName returns the name of the mock struct. If there are multiple structs in the file
+// the first one that embeds mock.Mock is used, otherwise the first struct.
+func (s *mockSource) structName() (string, error) {
+	first := ""
+	for _, decl := range s.file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			if embedsMock(structType) {
+				return typeSpec.Name.Name, nil
+			}
+			if first == "" {
+				first = typeSpec.Name.Name
+			}
+		}
+	}
+
+	if first == "" {
+		return "", errNotFound
+	}
+
+	return first, nil
+}
+
+func embedsMock(structType *ast.StructType) bool {
+	for _, field := range structType.Fields.List {
+		if len(field.Names) != 0 {
+			continue
+		}
+		sel, ok := field.Type.(*ast.SelectorExpr)
+		if ok && sel.Sel.Name == "Mock" {
+			return true
+		}
+	}
+	return false
+}
+
+// methods returns all methods with the given receiver type in the order they appear in the file.
+func (s *mockSource) methods(structName string) []*ast.FuncDecl {
+	methods := []*ast.FuncDecl{}
+	for _, decl := range s.file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if ok && receiverTypeName(fn) == structName {
+			methods = append(methods, fn)
+		}
+	}
+	return methods
+}
+
+// receiverName returns the name of the receiver variable used by the methods of the mock struct.
+// It falls back to the default if no method has a named receiver.
+func (s *mockSource) receiverName(structName string) string {
+	for _, fn := range s.methods(structName) {
+		names := fn.Recv.List[0].Names
+		if len(names) == 1 && names[0].Name != "_" {
+			return names[0].Name
+		}
+	}
+	return defaultReceiverName
+}
+
+// receiverTypeName returns the name of the receiver type of a method without pointer and
+// type parameters or an empty string for plain functions.
+func receiverTypeName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+
+	expr := fn.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.IndexExpr:
+		expr = t.X
+	case *ast.IndexListExpr:
+		expr = t.X
+	}
+
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	return ident.Name
+}
+
+// print renders the node including its doc comment and all comments inside of it.
+func (s *mockSource) print(node ast.Node) (string, error) {
+	start, end := nodeRange(node)
+	comments := []*ast.CommentGroup{}
+	for _, group := range s.file.Comments {
+		if group.Pos() >= start && (group.End() <= end || s.sameLine(group.Pos(), end)) {
+			comments = append(comments, group)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	err := printer.Fprint(buf, s.fset, &printer.CommentedNode{Node: node, Comments: comments})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to print node")
+	}
+
+	return buf.String(), nil
+}
+
+func nodeRange(node ast.Node) (token.Pos, token.Pos) {
+	start := node.Pos()
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		if n.Doc != nil {
+			start = n.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if n.Doc != nil {
+			start = n.Doc.Pos()
+		}
+	}
+	return start, node.End()
+}
+
+func (s *mockSource) sameLine(a, b token.Pos) bool {
+	return s.fset.Position(a).Line == s.fset.Position(b).Line
+}
+
+// text returns the source code between the two positions with normalized line endings.
+func (s *mockSource) text(start, end token.Pos) string {
+	text := string(s.src[s.fset.Position(start).Offset:s.fset.Position(end).Offset])
+	return strings.ReplaceAll(text, "\r\n", "\n")
+}
+
+// directive returns the mockgen:interface directive of the given struct or an empty string if there is none.
+func (s *mockSource) directive(structName string) string {
+	for _, directive := range parseDirectives(string(s.src)) {
+		if directive.StructName == structName {
+			return directive.String()
+		}
+	}
+	return ""
+}
+
+// signature renders the parameters and results of a method without its doc comment and body.
+func (s *mockSource) signature(fn *ast.FuncDecl) (string, error) {
+	buf := &bytes.Buffer{}
+	err := printer.Fprint(buf, s.fset, fn.Type)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to print signature of "+fn.Name.Name)
+	}
+	return buf.String(), nil
+}
+
+// header returns everything up to and including the package clause, e.g. license headers and build tags.
+func (s *mockSource) header() string {
+	return s.text(s.file.FileStart, s.file.Name.End())
+}
+
+// floatingComments returns all comments after the package clause that are neither part of a
+// declaration nor its doc comment.
+func (s *mockSource) floatingComments() []*ast.CommentGroup {
+	comments := []*ast.CommentGroup{}
+	for _, group := range s.file.Comments {
+		if group.Pos() < s.file.Name.End() {
+			continue
+		}
+
+		attached := false
+		for _, decl := range s.file.Decls {
+			start, end := nodeRange(decl)
+			if group.Pos() >= start && (group.End() <= end || s.sameLine(group.Pos(), end)) {
+				attached = true
+				break
+			}
+		}
+		if !attached {
+			comments = append(comments, group)
+		}
+	}
+	return comments
+}
+
+// generatedMethodRegex matches the doc comment of generated mock methods, e.g.
+// "Get is a mock implementation of example.Exampler#Get.".
+var generatedMethodRegex = regexp.MustCompile(`^(\w+) is a mock implementation of (\S+)#(\w+)\.`)
+
+// generatedFor returns the interface the method was generated for, e.g. example.Exampler, or an empty string
+// if it does not have the doc comment of a generated method.
+func generatedFor(fn *ast.FuncDecl) string {
+	if fn.Doc == nil {
+		return ""
+	}
+	match := generatedMethodRegex.FindStringSubmatch(fn.Doc.Text())
+	if match == nil || match[1] != fn.Name.Name || match[3] != fn.Name.Name {
+		return ""
+	}
+	return match[2]
+}
+
+// interfaceRef returns the interface the methods of the mock are generated for, e.g. example.Exampler.
+func (s *mockSource) interfaceRef(structName string) string {
+	for _, fn := range s.methods(structName) {
+		if ref := generatedFor(fn); ref != "" {
+			return ref
+		}
+	}
+	return ""
+}
+
+// mockMethod is a method of the mock struct together with the file it was parsed from.
+type mockMethod struct {
+	source *mockSource
+	decl   *ast.FuncDecl
+	code   string // Source code of the method if it was rewritten or edited instead of taken over as it is.
+}
+
+func (m mockMethod) print() (string, error) {
+	if m.code != "" {
+		return m.code, nil
+	}
+	return m.source.print(m.decl)
+}
+
+// Strategies for updating methods whose signature has changed.
+const (
+	strategyRegenerate = "regenerate" // Replace the method with the newly generated one.
+	strategyRewrite    = "rewrite"    // Keep the existing body and only adapt the mechanical parts.
+)
+
+// Places where customized methods are archived when they are removed or regenerated.
+const (
+	archiveSection = "section" // A commented-out section at the end of the mock file.
+	archiveFile    = "file"    // A sidecar file next to the mock file, see archivePath.
+)
+
+// updateOptions configures how existing mocks are updated.
+type updateOptions struct {
+	strategy string
+	resolver conflictResolver // Asks how to update changed methods instead of applying the strategy, optional.
+	archive  string           // Where to archive removed or regenerated methods, empty to drop them.
+	layout   layout
+
+	resolveAliases bool // New and regenerated methods use the types that aliases stand for.
+}
+
+func (o updateOptions) validate() error {
+	if o.strategy != strategyRegenerate && o.strategy != strategyRewrite {
+		return fmt.Errorf("unknown update strategy %q", o.strategy)
+	}
+	if o.archive != "" && o.archive != archiveSection && o.archive != archiveFile {
+		return fmt.Errorf("unknown archive option %q", o.archive)
+	}
+	return o.layout.validate()
+}
+
+// mergeResult is the outcome of merging a generated mock into an existing one.
+type mergeResult struct {
+	source   string
+	warnings []string
+	archived []string // Commented-out methods that were removed or regenerated.
+	report   *changeReport
+}
+
+// merger merges a freshly generated mock into an existing one.
+type merger struct {
+	existing   *mockSource
+	generated  *mockSource
+	structName string
+	importer   types.Importer
+	opts       updateOptions
+
+	chosen   map[string]mockMethod
+	warnings []string
+	archived []archivedMethod
+	report   *changeReport
+}
+
+// combineMethods picks the existing implementation for every new method with an unchanged
+// signature. Signatures are compared by their types so renamed parameters or different import
+// aliases do not count as a change. Methods with a changed signature are handled according to
+// the update strategy or by asking the resolver.
+func (mg *merger) combineMethods() error {
+	existingMethods := mg.existing.methods(mg.structName)
+	newMethods := mg.generated.methods(mg.structName)
+	if duplicates := duplicateMethods(existingMethods); len(duplicates) > 0 {
+		return fmt.Errorf("existing mock is ambiguous, methods declared more than once for %s: %s", mg.structName, strings.Join(duplicates, ", "))
+	}
+
+	mg.chosen = make(map[string]mockMethod, len(newMethods))
+	mg.report = newChangeReport()
+	for _, fn := range newMethods {
+		mg.chosen[fn.Name.Name] = mockMethod{source: mg.generated, decl: fn}
+
+		existingFn := findMethod(existingMethods, fn.Name.Name)
+		if existingFn == nil {
+			mg.report.Added = append(mg.report.Added, fn.Name.Name)
+			continue
+		}
+
+		same, err := sameSignature(mg.existing, existingFn, mg.generated, fn)
+		if err != nil {
+			return err
+		}
+		if same {
+			mg.chosen[fn.Name.Name] = mockMethod{source: mg.existing, decl: existingFn}
+			mg.report.keep(fn.Name.Name, keptUnchanged)
+			continue
+		}
+
+		if mg.opts.resolver != nil {
+			err = mg.resolveConflict(existingFn, fn)
+			if err != nil {
+				return err
+			}
+		} else if mg.opts.strategy == strategyRewrite {
+			rewritten, err := rewriteMethod(mg.existing, existingFn, mg.generated, fn)
+			if err != nil {
+				mg.warnings = append(mg.warnings, fmt.Sprintf("%s could not be rewritten safely and was regenerated instead: %s", fn.Name.Name, err))
+			} else {
+				mg.chosen[fn.Name.Name] = mockMethod{source: mg.existing, decl: existingFn, code: rewritten}
+			}
+		}
+
+		if mg.chosen[fn.Name.Name].source != mg.generated {
+			mg.report.keep(fn.Name.Name, keptCustomized)
+			continue
+		}
+		mg.report.Regenerated = append(mg.report.Regenerated, fn.Name.Name)
+		err = mg.archiveRegenerated(existingFn, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// duplicateMethods returns the names of all methods that are declared more than once,
+// e.g. with a value and with a pointer receiver.
+func duplicateMethods(methods []*ast.FuncDecl) []string {
+	count := map[string]int{}
+	duplicates := []string{}
+	for _, fn := range methods {
+		count[fn.Name.Name]++
+		if count[fn.Name.Name] == 2 {
+			duplicates = append(duplicates, fn.Name.Name)
+		}
+	}
+	return duplicates
+}
+
+// findMethod returns the method with exactly the given name.
+func findMethod(methods []*ast.FuncDecl, name string) *ast.FuncDecl {
+	for _, fn := range methods {
+		if fn.Name.Name == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// sameSignature reports whether the parameter and result types of both methods are identical,
+// ignoring the names. If the types could not be resolved the source code is compared instead.
+func sameSignature(existing *mockSource, existingFn *ast.FuncDecl, generated *mockSource, newFn *ast.FuncDecl) (bool, error) {
+	existingType, newType := existing.typeOf(existingFn), generated.typeOf(newFn)
+	if existingType != nil && newType != nil {
+		return identicalTypes(existingType, newType), nil
+	}
+
+	existingSig, err := existing.signature(existingFn)
+	if err != nil {
+		return false, err
+	}
+	newSig, err := generated.signature(newFn)
+	if err != nil {
+		return false, err
+	}
+	return existingSig == newSig, nil
+}
+
+// addMissingImports adds the imports of the generated mock that the existing mock does not have yet.
+func (mg *merger) addMissingImports() error {
+	existing := map[string]string{}
+	for _, spec := range mg.existing.file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return errors.Wrap(err, "invalid import path "+spec.Path.Value)
+		}
+		if name := mg.importName(spec, path); name != "_" && name != "." {
+			existing[path] = name
+		}
+	}
+
+	renamed := map[string]string{}
+	for _, spec := range mg.generated.file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return errors.Wrap(err, "invalid import path "+spec.Path.Value)
+		}
+
+		// Packages that are already imported keep their name, the new methods are changed to use it.
+		if name, ok := existing[path]; ok {
+			if generatedName := mg.importName(spec, path); generatedName != name {
+				renamed[generatedName] = name
+			}
+			continue
+		}
+
+		name := ""
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		astutil.AddNamedImport(mg.existing.fset, mg.existing.file, name, path)
+	}
+
+	if len(renamed) > 0 {
+		ast.Inspect(mg.generated.file, func(node ast.Node) bool {
+			sel, ok := node.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			// Package names are not resolved to a local object by the parser.
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+				if name, ok := renamed[ident.Name]; ok {
+					ident.Name = name
+				}
+			}
+			return true
+		})
+	}
+	return nil
+}
+
+// importName returns the name under which the import is used in the file.
+func (mg *merger) importName(spec *ast.ImportSpec, path string) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	if mg.importer != nil {
+		if pkg, err := mg.importer.Import(path); err == nil {
+			return pkg.Name()
+		}
+	}
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// merge updates the existing mock with the methods chosen by combineMethods. Everything in the existing
+// file that does not belong to a method of the interface, like headers, helper methods or additional struct
+// fields, is kept where it is. Methods that are new are appended at the end. The imports of both files are
+// merged and the ones that are not used anymore are removed.
+func (mg *merger) merge() (*mergeResult, error) {
+	mg.existing.typeCheck(mg.importer)
+	mg.generated.typeCheck(mg.importer)
+
+	// The imports are merged before the methods, so the generated code already uses the names of the
+	// existing imports when parts of it are copied into rewritten methods.
+	err := mg.addMissingImports()
+	if err != nil {
+		return nil, err
+	}
+
+	err = mg.combineMethods()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := []string{mg.existing.header()}
+
+	// By keeping the order of the existing file we can keep git diffs minimal.
+	comments := mg.existing.floatingComments()
+	for _, decl := range mg.existing.file.Decls {
+		for len(comments) > 0 && comments[0].Pos() < decl.Pos() {
+			parts = append(parts, mg.existing.text(comments[0].Pos(), comments[0].End()))
+			comments = comments[1:]
+		}
+
+		part, err := mg.mergeDecl(decl)
+		if err != nil {
+			return nil, err
+		}
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	for _, fn := range mg.generated.methods(mg.structName) {
+		if method, ok := mg.chosen[fn.Name.Name]; ok {
+			part, err := method.print()
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		}
+	}
+
+	// Comments at the end of the file, like the archive section, stay at the end.
+	for _, group := range comments {
+		parts = append(parts, mg.existing.text(group.Pos(), group.End()))
+	}
+
+	archived := mg.archivedMethods()
+	if mg.opts.archive == archiveSection && len(archived) > 0 {
+		if !strings.Contains(string(mg.existing.src), archiveHeader) {
+			parts = append(parts, archiveHeader)
+		}
+		parts = append(parts, archived...)
+	}
+
+	source, err := formatMock(mg.existing.name, strings.Join(parts, "\n\n")+"\n")
+	if err != nil {
+		return nil, err
+	}
+
+	return &mergeResult{source: source, warnings: mg.warnings, archived: archived, report: mg.report}, nil
+}
+
+// mergeDecl renders a declaration of the existing mock. Methods owned by the interface are replaced by the
+// chosen implementation and removed from chosen, generated methods that are not part of the interface anymore
+// are dropped or archived.
+// The mockgen:interface directive is added to the mock struct if it does not have one yet.
+func (mg *merger) mergeDecl(decl ast.Decl) (string, error) {
+	if gen, ok := decl.(*ast.GenDecl); ok {
+		return mg.mergeGenDecl(gen)
+	}
+
+	fn, ok := decl.(*ast.FuncDecl)
+	if !ok || receiverTypeName(fn) != mg.structName {
+		return mg.existing.print(decl)
+	}
+
+	method, ok := mg.chosen[fn.Name.Name]
+	if !ok {
+		// Only methods that were generated for the previous version of the interface are removed. Everything
+		// else might be a helper, so it is kept and reported.
+		ref := generatedFor(fn)
+		if ref != "" && (ref == mg.generated.interfaceRef(mg.structName) || mg.generated.interfaceRef(mg.structName) == "") {
+			mg.report.Removed = append(mg.report.Removed, fn.Name.Name)
+			return "", mg.archive(fn, "was removed from the interface")
+		}
+		mg.report.Orphaned = append(mg.report.Orphaned, fn.Name.Name)
+		return mg.existing.print(decl)
+	}
+
+	delete(mg.chosen, fn.Name.Name)
+	return method.print()
+}
+
+func (mg *merger) mergeGenDecl(decl *ast.GenDecl) (string, error) {
+	part, err := mg.existing.print(decl)
+	if err != nil {
+		return "", err
+	}
+
+	directive := mg.generated.directive(mg.structName)
+	if directive == "" || decl.Tok != token.TYPE || decl.Lparen.IsValid() || len(decl.Specs) != 1 {
+		return part, nil
+	}
+	spec, ok := decl.Specs[0].(*ast.TypeSpec)
+	if !ok || spec.Name.Name != mg.structName || len(parseDirectives(part)) > 0 {
+		return part, nil
+	}
+	mg.report.DirectiveAdded = true
+	if decl.Doc == nil {
+		return directive + "\n" + part, nil
+	}
+
+	// The directive goes to the end of the doc comment, so the declaration is printed without it.
+	withoutDoc := *decl
+	withoutDoc.Doc = nil
+	part, err = mg.existing.print(&withoutDoc)
+	if err != nil {
+		return "", err
+	}
+	doc := mg.existing.text(decl.Doc.Pos(), decl.Doc.End())
+	return doc + "\n//\n" + directive + "\n" + part, nil
+}
+
+// formatMock formats the merged mock and removes imports that are not used anymore.
+func formatMock(filename string, src string) (string, error) {
+	result, err := imports.Process(filename, []byte(src), &imports.Options{Comments: true, TabIndent: true, TabWidth: 8})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to format merged mock")
+	}
+
+	return string(result), nil
+}
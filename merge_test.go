@@ -0,0 +1,569 @@
+package main
+
+import (
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const generatedMock = `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	args := m.Called(id)
+
+	return args.String(0), args.Error(1)
+}
+
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id int) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+`
+
+// modelImporter returns an importer for a package github.com/some-path/model with the types StructA and StructB.
+func modelImporter() packageImporter {
+	model := types.NewPackage("github.com/some-path/model", "model")
+	for _, name := range []string{"StructA", "StructB"} {
+		obj := types.NewTypeName(token.NoPos, model, name, nil)
+		types.NewNamed(obj, types.NewStruct(nil, nil), nil)
+		model.Scope().Insert(obj)
+	}
+	model.MarkComplete()
+	return packageImporter{model.Path(): model}
+}
+
+func TestCalcResultMock(t *testing.T) {
+	existingMock := `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+	calls int
+}
+
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	args := m.Called(id)
+
+	convert := func(v interface{}) string {
+		if v == nil {
+			return ""
+		}
+
+		return v.(string)
+	}
+
+	// Custom logic.
+	return convert(args.Get(0)), args.Error(1)
+}
+
+
+
+// Update is a mock implementation of example.Exampler#Update.
+func (m *TestMock) Update(id int) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+`
+
+	expected := `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+	calls int
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	args := m.Called(id)
+
+	convert := func(v interface{}) string {
+		if v == nil {
+			return ""
+		}
+
+		return v.(string)
+	}
+
+	// Custom logic.
+	return convert(args.Get(0)), args.Error(1)
+}
+
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id int) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+`
+
+	for name, input := range map[string]string{
+		"LF":   existingMock,
+		"CRLF": strings.ReplaceAll(existingMock, "\n", "\r\n"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			existing, err := parseMock("existing.go", input)
+			require.NoError(t, err)
+			structName, err := existing.structName()
+			require.NoError(t, err)
+			assert.Equal(t, "TestMock", structName)
+
+			result, err := calcResultMock(existing, generatedMock, structName, packageImporter{}, updateOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, expected, result.source)
+		})
+	}
+}
+
+func TestCalcResultMockKeepsUserCode(t *testing.T) {
+	existingMock := `// Copyright 2022 Example Corp.
+
+//go:build !production
+
+package examplemock
+
+import (
+	"errors"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// ErrDefault is returned by the default setup.
+var ErrDefault = errors.New("default")
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// SetupDefaults registers the default expectations.
+func (m *TestMock) SetupDefaults() {
+	m.On("Delete", mock.Anything).Return(ErrDefault)
+}
+
+// Update is a mock implementation of example.Exampler#Update.
+func (m *TestMock) Update(id int) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	args := m.Called(id)
+
+	return args.String(0), args.Error(1)
+}
+
+// Methods that are only used in the tests of the service package.
+
+func newTestMock() *TestMock {
+	return &TestMock{}
+}
+`
+
+	expected := `// Copyright 2022 Example Corp.
+
+//go:build !production
+
+package examplemock
+
+import (
+	"errors"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// ErrDefault is returned by the default setup.
+var ErrDefault = errors.New("default")
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// SetupDefaults registers the default expectations.
+func (m *TestMock) SetupDefaults() {
+	m.On("Delete", mock.Anything).Return(ErrDefault)
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	args := m.Called(id)
+
+	return args.String(0), args.Error(1)
+}
+
+// Methods that are only used in the tests of the service package.
+
+func newTestMock() *TestMock {
+	return &TestMock{}
+}
+
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id int) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+`
+
+	existing, err := parseMock("existing.go", existingMock)
+	require.NoError(t, err)
+
+	result, err := calcResultMock(existing, generatedMock, "TestMock", packageImporter{}, updateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, expected, result.source)
+}
+
+func TestCalcResultMockKeepsHelperMethods(t *testing.T) {
+	existingMock := `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Reset forwards to the mock, so expectations can be set for it.
+func (m *TestMock) Reset() {
+	m.Called()
+}
+
+// Close is a mock implementation of io.Closer#Close.
+func (m *TestMock) Close() error {
+	return m.Called().Error(0)
+}
+
+// Update is a mock implementation of example.Exampler#Update.
+func (m *TestMock) Update(id int) error {
+	return m.Called(id).Error(0)
+}
+`
+
+	expected := `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Reset forwards to the mock, so expectations can be set for it.
+func (m *TestMock) Reset() {
+	m.Called()
+}
+
+// Close is a mock implementation of io.Closer#Close.
+func (m *TestMock) Close() error {
+	return m.Called().Error(0)
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	args := m.Called(id)
+
+	return args.String(0), args.Error(1)
+}
+
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id int) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+`
+
+	existing, err := parseMock("existing.go", existingMock)
+	require.NoError(t, err)
+
+	result, err := calcResultMock(existing, generatedMock, "TestMock", packageImporter{}, updateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, expected, result.source)
+	assert.Equal(t, []string{"Update"}, result.report.Removed)
+	assert.Equal(t, []string{"Reset", "Close"}, result.report.Orphaned)
+}
+
+func TestCalcResultMockWithCustomReceivers(t *testing.T) {
+	existingMock := `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (mock TestMock) Get(id int) (string, error) {
+	args := mock.Called(id)
+
+	return "custom", args.Error(1)
+}
+
+// Delete is a mock implementation of example.Exampler#Delete.
+func (mk *TestMock) Delete(id int) error {
+	return mk.Called(id).Error(0)
+}
+`
+
+	existing, err := parseMock("existing.go", existingMock)
+	require.NoError(t, err)
+	assert.Equal(t, "mock", existing.receiverName("TestMock"))
+
+	result, err := calcResultMock(existing, generatedMock, "TestMock", packageImporter{}, updateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, existingMock, result.source)
+}
+
+func TestCalcResultMockComparesSignatureTypes(t *testing.T) {
+	imp := modelImporter()
+
+	existingMock := `package examplemock
+
+import (
+	mdl "github.com/some-path/model"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Find is a mock implementation of example.Exampler#Find.
+func (m *TestMock) Find(n, a string, rest ...int) (*mdl.StructA, error) {
+	return nil, nil
+}
+
+// Load is a mock implementation of example.Exampler#Load.
+func (m *TestMock) Load(id int) *mdl.StructA {
+	return nil
+}
+`
+
+	newMock := `package examplemock
+
+import (
+	"github.com/some-path/model"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Find is a mock implementation of example.Exampler#Find.
+func (m *TestMock) Find(name string, address string, ids ...int) (*model.StructA, error) {
+	return nil, nil
+}
+
+// Load is a mock implementation of example.Exampler#Load.
+func (m *TestMock) Load(id int) *model.StructB {
+	return nil
+}
+`
+
+	expected := `package examplemock
+
+import (
+	mdl "github.com/some-path/model"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Find is a mock implementation of example.Exampler#Find.
+func (m *TestMock) Find(n, a string, rest ...int) (*mdl.StructA, error) {
+	return nil, nil
+}
+
+// Load is a mock implementation of example.Exampler#Load.
+func (m *TestMock) Load(id int) *mdl.StructB {
+	return nil
+}
+`
+
+	existing, err := parseMock("existing.go", existingMock)
+	require.NoError(t, err)
+
+	result, err := calcResultMock(existing, newMock, "TestMock", imp, updateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, expected, result.source)
+}
+
+func TestCalcResultMockMatchesExactMethodNames(t *testing.T) {
+	existingMock := `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// GetAll is a mock implementation of example.Exampler#GetAll.
+func (m *TestMock) GetAll() error {
+	return nil
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	return "custom", nil
+}
+`
+
+	newMock := `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	args := m.Called(id)
+
+	return args.String(0), args.Error(1)
+}
+
+// GetA is a mock implementation of example.Exampler#GetA.
+func (m *TestMock) GetA() error {
+	args := m.Called()
+
+	return args.Error(0)
+}
+`
+
+	expected := `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	return "custom", nil
+}
+
+// GetA is a mock implementation of example.Exampler#GetA.
+func (m *TestMock) GetA() error {
+	args := m.Called()
+
+	return args.Error(0)
+}
+`
+
+	existing, err := parseMock("existing.go", existingMock)
+	require.NoError(t, err)
+	result, err := calcResultMock(existing, newMock, "TestMock", packageImporter{}, updateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, expected, result.source)
+
+	existing, err = parseMock("existing.go", existingMock+`
+// Get is declared a second time.
+func (m TestMock) Get(id int) (string, error) {
+	return "", nil
+}
+`)
+	require.NoError(t, err)
+	_, err = calcResultMock(existing, newMock, "TestMock", packageImporter{}, updateOptions{})
+	assert.EqualError(t, err, "existing mock is ambiguous, methods declared more than once for TestMock: Get")
+}
+
+func TestCalcResultMockAddsDirective(t *testing.T) {
+	directive := "//mockgen:interface github.com/some-path/example.Exampler struct=TestMock"
+	newMock := strings.Replace(generatedMock, "type TestMock struct", "//\n"+directive+"\ntype TestMock struct", 1)
+
+	existingMock := `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+// Embed type TestMock in fixtures to share expectations.
+type TestMock struct {
+	mock.Mock
+}
+
+type (
+	// Other is not the mock.
+	Other struct{}
+)
+`
+	expected := `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+// Embed type TestMock in fixtures to share expectations.
+//
+` + directive + `
+type TestMock struct {
+	mock.Mock
+}
+
+type (
+	// Other is not the mock.
+	Other struct{}
+)
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id int) (string, error) {
+	args := m.Called(id)
+
+	return args.String(0), args.Error(1)
+}
+
+// Delete is a mock implementation of example.Exampler#Delete.
+func (m *TestMock) Delete(id int) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+`
+
+	existing, err := parseMock("existing.go", existingMock)
+	require.NoError(t, err)
+	result, err := calcResultMock(existing, newMock, "TestMock", packageImporter{}, updateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, expected, result.source)
+
+	// Without doc comment the directive becomes the doc comment.
+	existing, err = parseMock("existing.go", strings.Replace(existingMock, "// TestMock is a mock implementation of the example.Exampler interface.\n// Embed type TestMock in fixtures to share expectations.\n", "", 1))
+	require.NoError(t, err)
+	result, err = calcResultMock(existing, newMock, "TestMock", packageImporter{}, updateOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, result.source, "\n\n"+directive+"\ntype TestMock struct {")
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"bytes"
 	"context"
-	"flag"
 	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
 	"go/types"
 	"io"
 	"io/ioutil"
@@ -20,122 +23,205 @@ import (
 
 var errNotFound = errors.New("entity not found")
 
-var structNameRegex = regexp.MustCompile(`type (.*) struct \{`)
-var preambleRegex = regexp.MustCompile(`(?s)^(.*type .*? struct \{\n\tmock.Mock\n\}\n\n)(.*)$`)
-var signatureRegex = regexp.MustCompile(`func \(..? \*.*?\) (.*) \{`)
+const defaultReceiverName = "m"
 
-type functionBlock struct {
-	fullFunction string
-	signature    string
+func main() {
+	os.Exit(newCLI().run(os.Args[1:]))
 }
 
-func main() {
-	flag.Usage = func() {
-		fmt.Printf("Usage of %s\n\n", os.Args[0])
-		fmt.Printf("--- Generate a new mock file ---\n")
-		fmt.Printf("%s <folderPath> <interfaceName> <mockStructName>\n", os.Args[0])
-		fmt.Printf("Example: %s ./pkg/gateway Gatewayer Gateway\n\n", os.Args[0])
+// newOptions configures how new mocks are generated.
+type newOptions struct {
+	receiverName   string
+	resolveAliases bool // Use the types that aliases stand for instead of the aliases.
+	layout         layout
+}
 
-		fmt.Println("--- Update an existing mock file ---")
-		fmt.Printf("%s <folderPath> <interfaceName> -f\n", os.Args[0])
-		fmt.Printf("Example: %s ./pkg/gateway Gatewayer -f\n\n", os.Args[0])
-	}
+// reservedNames are used by the code in the generated methods, so they can not be the name of the receiver.
+var reservedNames = map[string]bool{"_": true, "args": true, "_va": true, "_ca": true, "_i": true, "mock": true}
 
-	flag.Parse()
+func (o newOptions) validate() error {
+	if !token.IsIdentifier(o.receiverName) {
+		return fmt.Errorf("the receiver name %q is not a valid identifier", o.receiverName)
+	}
+	if reservedNames[o.receiverName] {
+		return fmt.Errorf("the receiver name %q is used by the generated code", o.receiverName)
+	}
+	return o.layout.validate()
+}
 
-	if os.Args[3] != "-f" {
-		fmt.Println("Generating new mock...")
-		err := generateNewMock(os.Args[1], os.Args[2], os.Args[3])
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		fmt.Println("Success!")
-	} else {
-		fmt.Println("Updating existing mock...")
-		err := updateMock(os.Args[1], os.Args[2])
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		fmt.Println("Success!")
+func generateNewMock(interfaceFile, interfaceName, structName string, opts newOptions) error {
+	mock, err := planNewMock(interfaceFile, interfaceName, structName, opts)
+	if err != nil {
+		return err
 	}
+
+	return writeMock(mock, "")
 }
 
-func generateNewMock(interfaceFile, interfaceName, structName string) error {
-	iface, err := findInterface(interfaceFile, interfaceName)
+// planNewMock generates a new mock without writing it.
+func planNewMock(interfaceFile, interfaceName, structName string, opts newOptions) (*mockUpdate, error) {
+	iface, dir, err := locateInterface(interfaceFile, interfaceName)
 	if err != nil {
-		return errors.Wrap(err, "problem finding interface")
+		return nil, errors.Wrap(err, "problem finding interface")
 	}
 
-	path := filepath.Dir(interfaceFile)
-	// Create mock folder if it does not exist.
-	folderPath := folderPath(path, iface)
-	if _, err = os.Stat(folderPath); os.IsNotExist(err) {
-		err = os.Mkdir(folderPath, os.ModePerm)
-		if err != nil {
-			return errors.Wrap(err, "failed to create directory")
-		}
+	return planInterfaceMock(dir, iface, structName, opts)
+}
+
+// planInterfaceMock generates a new mock for the interface in the package in path without writing it.
+func planInterfaceMock(path string, iface *Interface, structName string, opts newOptions) (*mockUpdate, error) {
+	err := opts.layout.validate()
+	if err != nil {
+		return nil, err
+	}
+	folder, err := opts.layout.folder(path, iface)
+	if err != nil {
+		return nil, err
+	}
+	fileName, err := opts.layout.fileName(path, iface, structName)
+	if err != nil {
+		return nil, err
+	}
+	pkgName, err := opts.layout.packageName(path, iface)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check if the mock file already exists.
-	filePath := folderPath + "/" + strings.ToLower(structName) + ".go"
-	if _, err = os.Stat(filePath); err == nil {
-		return fmt.Errorf("file %s already exists, delete it before re-generating it", filePath)
+	filePath := filepath.Join(folder, fileName)
+	if _, err := os.Stat(filePath); err == nil {
+		return nil, fmt.Errorf("file %s already exists, delete it before re-generating it", filePath)
 	} else if !os.IsNotExist(err) {
-		return errors.Wrap(err, "failed to determine whether file exists")
+		return nil, errors.Wrap(err, "failed to determine whether file exists")
+	}
+
+	buf := &bytes.Buffer{}
+	err = generateMock(iface, mockPackage{name: pkgName, local: opts.layout.local()}, structName, opts.receiverName, opts.resolveAliases, buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate mock")
+	}
+
+	report := newChangeReport()
+	report.Mock = filePath
+	report.Interface = interfaceID(iface)
+	report.Created = true
+	for _, method := range iface.Methods() {
+		report.Added = append(report.Added, method.Name)
+	}
+
+	return &mockUpdate{path: filePath, after: buf.String(), report: report}, nil
+}
+
+// mockUpdate is a new or updated mock that was not written yet.
+type mockUpdate struct {
+	path     string
+	before   string // Empty for new mocks.
+	after    string
+	archived []string
+	report   *changeReport
+}
+
+// stale reports whether the mock on disk differs from the updated one.
+func (u *mockUpdate) stale() bool {
+	return u.before != u.after
+}
+
+// updateMock updates the existing mock of the interface and reports what was changed.
+func updateMock(interfaceFile, interfaceName string, opts updateOptions) (*changeReport, error) {
+	update, err := planUpdate(interfaceFile, interfaceName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeMock(update, opts.archive)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create file to write the mock into.
-	f, err := os.Create(filePath) //nolint: gosec
+	return update.report, nil
+}
+
+// writeMock writes the new or updated mock and its archived methods if they are archived in a sidecar file.
+func writeMock(mock *mockUpdate, archive string) error {
+	// Create mock folder if it does not exist.
+	err := os.MkdirAll(filepath.Dir(mock.path), os.ModePerm)
 	if err != nil {
-		return errors.Wrap(err, "failed to create file")
+		return errors.Wrap(err, "failed to create directory")
 	}
-	defer close(f)
 
-	err = generateMock(iface, structName, f)
+	err = ioutil.WriteFile(mock.path, []byte(mock.after), 0644) //nolint: gosec
 	if err != nil {
-		return errors.Wrap(err, "failed to generate mock")
+		return errors.Wrap(err, "failed to write result in file")
 	}
 
+	if archive == archiveFile {
+		return writeArchive(mock.path, mock.archived)
+	}
 	return nil
 }
 
-func updateMock(interfaceFile, interfaceName string) error {
-	iface, err := findInterface(interfaceFile, interfaceName)
+// planUpdate runs the update of the existing mock of the interface without writing anything.
+func planUpdate(interfaceFile, interfaceName string, opts updateOptions) (*mockUpdate, error) {
+	iface, dir, err := locateInterface(interfaceFile, interfaceName)
 	if err != nil {
-		return errors.Wrap(err, "problem finding interface")
+		return nil, errors.Wrap(err, "problem finding interface")
 	}
 
-	path := filepath.Dir(interfaceFile)
-	existingMock, pathToExistingFile, err := readExistingFiles(path, iface)
+	return planInterfaceUpdate(dir, iface, opts)
+}
+
+// planInterfaceUpdate updates the mock of the interface in the package in path without writing anything.
+func planInterfaceUpdate(path string, iface *Interface, opts updateOptions) (*mockUpdate, error) {
+	err := opts.validate()
 	if err != nil {
-		return errors.Wrap(err, "failed to read existing file(s)")
+		return nil, err
 	}
 
-	structName, err := extractStructName(existingMock)
+	existingFile, err := opts.layout.existingMock(path, iface)
 	if err != nil {
-		return errors.Wrap(err, "failed to find struct name")
+		return nil, errors.Wrap(err, "failed to read existing file(s)")
 	}
 
-	buf := &bytes.Buffer{}
-	err = generateMock(iface, structName, buf)
+	existing, err := parseMock(existingFile.path, existingFile.content)
 	if err != nil {
-		return errors.Wrap(err, "failed to generate virtual mock")
+		return nil, errors.Wrap(err, "failed to parse existing mock")
 	}
-	virtualNewMock := buf.String()
 
-	result, err := calcResultMock(existingMock, virtualNewMock)
+	structName := existingFile.structName
+	if structName == "" {
+		structName, err = existing.structName()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find struct name")
+		}
+	}
+
+	// New methods use the same receiver name as the existing ones.
+	receiverName := existing.receiverName(structName)
+
+	buf := &bytes.Buffer{}
+	// The mock is part of the package of the interface if it is in the same directory and not in the external test package.
+	pkgName := existing.file.Name.Name
+	pkg := mockPackage{name: pkgName, local: pkgName == iface.Pkg.Name() && sameDir(filepath.Dir(existingFile.path), path)}
+	err = generateMock(iface, pkg, structName, receiverName, opts.resolveAliases, buf)
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "failed to generate virtual mock")
 	}
+	virtualNewMock := buf.String()
 
-	err = ioutil.WriteFile(pathToExistingFile, []byte(result), os.ModePerm)
+	var imp types.Importer = newPackageImporter(iface.Pkg)
+	if pkg.local {
+		imp = localImporter{packageImporter: newPackageImporter(iface.Pkg), local: iface.Pkg}
+	}
+	result, err := calcResultMock(existing, virtualNewMock, structName, imp, opts)
 	if err != nil {
-		return errors.Wrap(err, "failed to write result in file")
+		return nil, err
 	}
 
-	return nil
+	report := result.report
+	report.Mock = existingFile.path
+	report.Interface = interfaceID(iface)
+	report.Warnings = append(report.Warnings, result.warnings...)
+	return &mockUpdate{path: existingFile.path, before: existingFile.content, after: result.source, archived: result.archived, report: report}, nil
 }
 
 // findInterface loads the package that the given interfaceFile is part of and retrieves the interface data
@@ -146,9 +232,115 @@ func findInterface(interfaceFile, interfaceName string) (*Interface, error) {
 		return nil, fmt.Errorf("failed to find absolute file path: %w", err)
 	}
 
-	mode := packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports
-	mode = mode | packages.NeedDeps | packages.NeedTypes | packages.NeedTypesSizes | packages.NeedSyntax | packages.NeedTypesInfo
-	pkgs, err := packages.Load(&packages.Config{Mode: mode}, absPath)
+	pkg, err := loadPackage(packageDir(absPath))
+	if err != nil {
+		return nil, err
+	}
+
+	return newInterface(pkg.Types, interfaceName, absPath)
+}
+
+// localMocksDir contains the mock folders of interfaces from dependencies and the standard library.
+const localMocksDir = "mocks"
+
+// locateInterface finds the interface and the directory in which its mock folder is created by default. The target
+// is a file or directory of the package or its import path. If the name is empty the target also contains the
+// interface name, e.g. net/http.RoundTripper or ./pkg/repository.Persister. Interfaces that are not part of the
+// main module are mocked into the local mocks folder, e.g. mocks/httpmock.
+func locateInterface(target, name string) (*Interface, string, error) {
+	if name == "" {
+		var ok bool
+		target, name, ok = splitQualifiedName(target)
+		if !ok {
+			return nil, "", fmt.Errorf("%s is not of the form <importPath>.<interfaceName>", target)
+		}
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		iface, err := findInterface(target, name)
+		return iface, packageDir(target), err
+	}
+
+	pkg, err := loadImportPath(target, ".")
+	if err != nil {
+		return nil, "", err
+	}
+	if len(pkg.Errors) > 0 {
+		return nil, "", fmt.Errorf("failed to load package %s: %v", target, pkg.Errors[0])
+	}
+	iface, err := newInterface(pkg.Types, name, "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	if pkg.Module != nil && pkg.Module.Main && len(pkg.GoFiles) > 0 {
+		return iface, relativePath(filepath.Dir(pkg.GoFiles[0])), nil
+	}
+	return iface, localMocksDir, nil
+}
+
+// splitQualifiedName splits e.g. net/http.RoundTripper into the import path and the name of the interface.
+func splitQualifiedName(qualifiedName string) (string, string, bool) {
+	// The type arguments of an instantiation may contain dots as well, e.g. generic.Cache[string, *model.Session].
+	sep := strings.LastIndex(qualifiedName, ".")
+	if bracket := strings.Index(qualifiedName, "["); bracket >= 0 {
+		sep = strings.LastIndex(qualifiedName[:bracket], ".")
+	}
+	if sep <= strings.LastIndex(qualifiedName, "/")+1 || sep == len(qualifiedName)-1 {
+		return qualifiedName, "", false
+	}
+	return qualifiedName[:sep], qualifiedName[sep+1:], true
+}
+
+// qualifiedInterface reports whether the argument names an interface together with its package
+// instead of being a file or directory.
+func qualifiedInterface(arg string) bool {
+	if _, err := os.Stat(arg); err == nil || strings.HasSuffix(arg, ".go") {
+		return false
+	}
+	target, _, ok := splitQualifiedName(arg)
+	if ok && (build.IsLocalImport(target) || filepath.IsAbs(target)) {
+		// Paths on disk must exist, otherwise it is most likely a typo in a file name.
+		_, err := os.Stat(target)
+		return err == nil
+	}
+	return ok
+}
+
+// loadedPackages caches the loaded packages by their directory or import path. The packages do not change while
+// the tool runs and loading them again is slow when many mocks are generated at once.
+var loadedPackages = map[string]*packages.Package{}
+
+// loadMode loads the packages including the types of all their dependencies.
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports |
+	packages.NeedDeps | packages.NeedTypes | packages.NeedTypesSizes | packages.NeedSyntax | packages.NeedTypesInfo |
+	packages.NeedModule
+
+// loadPackage loads the package in the given directory including the types of all its dependencies.
+func loadPackage(dir string) (*packages.Package, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find absolute path: %w", err)
+	}
+	// Load the directory instead of single files so the package has its actual import path.
+	return loadPackagePattern(absDir, absDir, ".")
+}
+
+// loadImportPath loads the package with the given import path as it is resolved by the module in dir.
+func loadImportPath(importPath, dir string) (*packages.Package, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find absolute path: %w", err)
+	}
+	return loadPackagePattern(importPath, absDir, importPath)
+}
+
+func loadPackagePattern(key, dir, pattern string) (*packages.Package, error) {
+	if pkg, ok := loadedPackages[key]; ok {
+		return pkg, nil
+	}
+
+	pkgs, err := packages.Load(&packages.Config{Mode: loadMode, Dir: dir}, pattern)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load package with import path: %w", err)
 	}
@@ -157,35 +349,113 @@ func findInterface(interfaceFile, interfaceName string) (*Interface, error) {
 		return nil, fmt.Errorf("invalid number of packages found: %d", len(pkgs))
 	}
 
-	obj := pkgs[0].Types.Scope().Lookup(interfaceName)
+	loadedPackages[key] = pkgs[0]
+	return pkgs[0], nil
+}
+
+// loadPackages loads all packages that match the pattern, e.g. ./... or a single directory. The packages are
+// cached by their directory, so they are shared with loadPackage.
+func loadPackages(pattern string) ([]*packages.Package, error) {
+	absDir, err := filepath.Abs(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find absolute path: %w", err)
+	}
+
+	pkgs, err := packages.Load(&packages.Config{Mode: loadMode, Dir: absDir}, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+
+	loaded := []*packages.Package{}
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return nil, fmt.Errorf("failed to load package %s: %v", pkg.PkgPath, pkg.Errors[0])
+		}
+		if len(pkg.GoFiles) == 0 {
+			continue
+		}
+		key := filepath.Dir(pkg.GoFiles[0])
+		if cached, ok := loadedPackages[key]; ok {
+			pkg = cached
+		}
+		loadedPackages[key] = pkg
+		loaded = append(loaded, pkg)
+	}
+	if len(loaded) == 0 {
+		return nil, fmt.Errorf("no packages found for %s", pattern)
+	}
+	return loaded, nil
+}
+
+// packageInterfaces returns all interfaces and function types that are declared in the package.
+func packageInterfaces(pkg *types.Package) []*Interface {
+	interfaces := []*Interface{}
+	for _, name := range pkg.Scope().Names() {
+		iface, err := newInterface(pkg, name, "")
+		if err == nil {
+			interfaces = append(interfaces, iface)
+		}
+	}
+	return interfaces
+}
+
+// packageDir returns the directory of the package the path points to. The path can either be a directory
+// or a file in it.
+func packageDir(path string) string {
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		return filepath.Dir(path)
+	}
+	return path
+}
+
+// newInterface retrieves the interface or function type with the given name from the package. The name can
+// instantiate a generic type, e.g. Cache[string, *model.Session], then the mock uses the type arguments.
+func newInterface(pkg *types.Package, interfaceName, fileName string) (*Interface, error) {
+	interfaceName, typeArgs, err := splitTypeArgs(interfaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := pkg.Scope().Lookup(interfaceName)
 	if obj == nil {
-		fmt.Println("lookup failed")
-		return nil, errNotFound
+		return nil, errors.Wrapf(errNotFound, "%s is not declared in package %s", interfaceName, pkg.Path())
 	}
 
+	if _, ok := obj.(*types.TypeName); !ok {
+		return nil, errors.Wrapf(errNotFound, "%s is not a type", interfaceName)
+	}
 	typ, ok := obj.Type().(*types.Named)
 	if !ok {
-		fmt.Println("cast of Type failed")
-		return nil, errNotFound
+		return nil, errors.Wrapf(errNotFound, "%s is not a named type", interfaceName)
 	}
 
 	i := &Interface{
 		Name:          interfaceName,
-		Pkg:           pkgs[0].Types,
-		QualifiedName: pkgs[0].Types.Path(),
-		FileName:      absPath,
+		Pkg:           pkg,
+		QualifiedName: pkg.Path(),
+		FileName:      fileName,
 		NamedType:     typ,
 	}
+	if len(typeArgs) > 0 {
+		i.NamedType, i.TypeArgs, err = instantiate(pkg, obj, typeArgs)
+		if err != nil {
+			return nil, err
+		}
+		typ = i.NamedType
+	}
 
 	iface, ok := typ.Underlying().(*types.Interface)
 	if ok {
+		// Constraints like ~int | ~float64 can only be used as type parameters, nothing could use their mock.
+		if !iface.IsMethodSet() {
+			return nil, fmt.Errorf("%s is a constraint and can not be mocked", interfaceName)
+		}
 		i.IsFunction = false
 		i.ActualInterface = iface
 	} else {
 		sig, ok := typ.Underlying().(*types.Signature)
 		if !ok {
-			fmt.Println("cast to signature failed")
-			return nil, errNotFound
+			return nil, errors.Wrapf(errNotFound, "%s is neither an interface nor a function type", interfaceName)
 		}
 		i.IsFunction = true
 		i.SingleFunction = &Method{Name: "Execute", Signature: sig}
@@ -194,28 +464,88 @@ func findInterface(interfaceFile, interfaceName string) (*Interface, error) {
 	return i, nil
 }
 
-func calcResultMock(existingMock string, newMock string) (string, error) {
-	existingFunctions, _, err := extractBlocksAndPreamble(existingMock)
+// splitTypeArgs splits an instantiation like Cache[string, *model.Session] into the name of the generic type and
+// the expressions of its type arguments. Names without type arguments are returned as they are.
+func splitTypeArgs(name string) (string, []ast.Expr, error) {
+	if !strings.Contains(name, "[") {
+		return name, nil, nil
+	}
+
+	expr, err := parser.ParseExpr(name)
 	if err != nil {
-		return "", errors.Wrap(err, "extraction failed for existing file")
+		return "", nil, fmt.Errorf("%s is not a valid instantiation of a generic type", name)
+	}
+	var base ast.Expr
+	var args []ast.Expr
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		base, args = e.X, []ast.Expr{e.Index}
+	case *ast.IndexListExpr:
+		base, args = e.X, e.Indices
+	}
+	ident, ok := base.(*ast.Ident)
+	if !ok {
+		return "", nil, fmt.Errorf("%s is not a valid instantiation of a generic type", name)
+	}
+	return ident.Name, args, nil
+}
+
+// instantiate instantiates the generic type with the type arguments. They are resolved in the file that declares
+// the type, so they can refer to its imports and to the types of its package. It also returns the type arguments
+// in their canonical form, e.g. [string, *model.Session].
+func instantiate(pkg *types.Package, obj types.Object, args []ast.Expr) (*types.Named, string, error) {
+	generic := obj.Type().(*types.Named)
+	if generic.TypeParams().Len() == 0 {
+		return nil, "", fmt.Errorf("%s is not generic and can not be instantiated", obj.Name())
 	}
-	newFunctions, newPreamble, err := extractBlocksAndPreamble(newMock)
+
+	targs := make([]types.Type, 0, len(args))
+	exprs := make([]string, 0, len(args))
+	for _, arg := range args {
+		expr := types.ExprString(arg)
+		tv, err := types.Eval(token.NewFileSet(), pkg, obj.Pos(), expr)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "failed to resolve type argument %s of %s", expr, obj.Name())
+		}
+		if !tv.IsType() {
+			return nil, "", fmt.Errorf("type argument %s of %s is not a type", expr, obj.Name())
+		}
+		targs = append(targs, tv.Type)
+		exprs = append(exprs, expr)
+	}
+
+	typ, err := types.Instantiate(nil, generic, targs, true)
 	if err != nil {
-		return "", errors.Wrap(err, "extraction failed for new mock")
+		return nil, "", errors.Wrapf(err, "failed to instantiate %s", obj.Name())
 	}
+	return typ.(*types.Named), "[" + strings.Join(exprs, ", ") + "]", nil
+}
 
-	bodyFunctions := combineFunctions(existingFunctions, newFunctions)
-	bodyStr := ""
-	for _, fn := range bodyFunctions {
-		bodyStr += fn.fullFunction + "\n\n"
+// calcResultMock merges the freshly generated mock into the existing one on the AST level. The importer
+// is used to resolve the types in the method signatures of both mocks.
+func calcResultMock(existing *mockSource, newMock string, structName string, imp types.Importer, opts updateOptions) (*mergeResult, error) {
+	generated, err := parseMock("new.go", newMock)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing failed for new mock")
 	}
-	bodyStr = strings.TrimSuffix(bodyStr, "\n")
-	return newPreamble + bodyStr, nil
+
+	mg := &merger{existing: existing, generated: generated, structName: structName, importer: imp, opts: opts}
+	return mg.merge()
 }
 
-func generateMock(iface *Interface, structName string, out io.Writer) error {
-	gen := NewGenerator(iface, structName)
-	gen.GeneratePrologue(context.TODO(), iface.Pkg.Name())
+// mockPackage is the package a mock is generated into.
+type mockPackage struct {
+	name  string
+	local bool // The mock is part of the package of the interface, so its types are not qualified.
+}
+
+func generateMock(iface *Interface, pkg mockPackage, structName, receiverName string, resolveAliases bool, out io.Writer) error {
+	gen := NewGenerator(iface, structName, receiverName)
+	gen.resolveAliases = resolveAliases
+	if pkg.local {
+		gen.localPkg = iface.Pkg.Path()
+	}
+	gen.GeneratePrologue(context.TODO(), pkg.name)
 	err := gen.Generate(context.TODO())
 	if err != nil {
 		return err
@@ -231,14 +561,26 @@ func close(resource io.Closer) {
 	}
 }
 
-func folderPath(path string, iface *Interface) string {
-	return path + "/" + iface.Pkg.Name() + "mock"
+// existingMock is the mock file that belongs to the interface that should be updated.
+type existingMock struct {
+	path       string
+	content    string
+	structName string // Only set if the file was found via the mockgen:interface directive.
 }
 
-func readExistingFiles(path string, iface *Interface) (string, string, error) {
+// readExistingFiles finds the mock of the interface in the given mock folder and, if recursive, its subfolders. Mocks are linked to their interface
+// via the mockgen:interface directive. Files without any directive are matched if one of their comments
+// contains <packageName>.<interfaceName> instead.
+func readExistingFiles(folder string, iface *Interface, recursive bool) (*existingMock, error) {
 	var files []string
-	err := filepath.Walk(folderPath(path, iface), func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != folder && !recursive {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || filepath.Ext(path) != ".go" {
 			return nil
 		}
 
@@ -246,96 +588,68 @@ func readExistingFiles(path string, iface *Interface) (string, string, error) {
 		return nil
 	})
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
+	commentRegex := regexp.MustCompile(`\b` + regexp.QuoteMeta(iface.Pkg.Name()+"."+iface.Name) + `\b`)
+	claimed := []*existingMock{}
+	mentioned := []*existingMock{}
 	for _, file := range files {
 		// nolint: gosec
 		blob, err := ioutil.ReadFile(file)
 		if err != nil {
-			return "", "", err
+			return nil, err
 		}
 		content := string(blob)
-		if strings.Contains(content, iface.Pkg.Name()+"."+iface.Name) {
-			return content, file, nil
-		}
-	}
-
-	return "", "", errNotFound
-}
-
-func extractStructName(content string) (string, error) {
-	matches := structNameRegex.FindStringSubmatch(content)
-	if len(matches) < 2 {
-		return "", errNotFound
-	}
-
-	return matches[1], nil
-}
-
-func extractBlocksAndPreamble(input string) ([]functionBlock, string, error) {
-	bodyMatches := preambleRegex.FindStringSubmatch(input)
-	if len(bodyMatches) < 3 {
-		return nil, "", errors.New("failed to find preamble and functions")
-	}
-
-	functions := strings.SplitAfter(bodyMatches[2], "\n}\n\n")
 
-	blocks := []functionBlock{}
-	for _, fn := range functions {
-		if strings.HasSuffix(fn, "\n\n") {
-			fn = strings.TrimRight(fn, "\n")
+		directives := parseDirectives(content)
+		for _, directive := range directives {
+			if directive.Interface == interfaceID(iface) {
+				claimed = append(claimed, &existingMock{path: file, content: content, structName: directive.StructName})
+			}
 		}
-
-		matches := signatureRegex.FindStringSubmatch(fn)
-		if len(matches) < 2 {
-			return nil, "", errors.New("failed to find function signature: " + fn)
-		}
-		block := functionBlock{
-			fullFunction: fn,
-			signature:    matches[1],
+		if len(directives) == 0 && commentRegex.MatchString(content) {
+			mentioned = append(mentioned, &existingMock{path: file, content: content})
 		}
-		blocks = append(blocks, block)
 	}
 
-	return blocks, bodyMatches[1], nil
+	if len(claimed) > 0 {
+		return onlyMock(claimed, interfaceID(iface))
+	}
+	if len(mentioned) > 0 {
+		return onlyMock(mentioned, interfaceID(iface))
+	}
+	return nil, errNotFound
 }
 
-func combineFunctions(existingFunctions []functionBlock, newFunctions []functionBlock) []functionBlock {
-	for i, fn := range newFunctions {
-		if foundFunction := findFunction(existingFunctions, fn.signature); foundFunction != nil {
-			newFunctions[i] = *foundFunction
-		}
-	}
+// noMock reports whether the error means that there is no mock for an interface.
+func noMock(err error) bool {
+	cause := errors.Cause(err)
+	return cause == errNotFound || os.IsNotExist(cause)
+}
 
-	result := []functionBlock{}
-	new := []functionBlock{}
-	// Collect all functions from newFunctions in the order they appear in the existing list.
-	// By keeping the order we can keep git diffs minimal.
-	for _, fn := range existingFunctions {
-		matches := strings.SplitN(fn.signature, "(", 2)
-		foundFunction := findFunction(newFunctions, matches[0])
-		if foundFunction != nil {
-			result = append(result, *foundFunction)
-		}
+func onlyMock(mocks []*existingMock, ifaceID string) (*existingMock, error) {
+	if len(mocks) == 1 {
+		return mocks[0], nil
 	}
 
-	// Collect all new functions that are still missing in the result from above.
-	for _, fn := range newFunctions {
-		matches := strings.SplitN(fn.signature, "(", 2)
-		foundFunction := findFunction(result, matches[0])
-		if foundFunction == nil {
-			new = append(new, fn)
-		}
+	paths := []string{}
+	for _, mock := range mocks {
+		paths = append(paths, mock.path)
 	}
-	return append(result, new...)
+	return nil, fmt.Errorf("found %d mocks for interface %s, there must only be one: %s", len(mocks), ifaceID, strings.Join(paths, ", "))
 }
 
-func findFunction(functions []functionBlock, signaturePrefix string) *functionBlock {
-	for _, fn := range functions {
-		if strings.HasPrefix(fn.signature, signaturePrefix) {
-			return &fn
+// relativePath returns the path relative to the working directory if it is below it, so the paths in the
+// report look the same as the ones given on the command line.
+func relativePath(path string) string {
+	if !filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
 		}
 	}
-	return nil
+	return path
 }
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/otiai10/copy"
@@ -20,9 +22,46 @@ func TestFindInterface(t *testing.T) {
 	assert.Equal(t, "FunctionZ", methods[2].Name)
 }
 
+func TestLocateInterface(t *testing.T) {
+	tests := map[string]struct {
+		target, name, dir string
+	}{
+		"file":                  {target: "./test/inputnew/example/types.go", name: "Exampler", dir: "test/inputnew/example"},
+		"directory":             {target: "./test/inputnew/example", name: "Exampler", dir: "./test/inputnew/example"},
+		"directory and name":    {target: "./test/inputnew/example.Exampler", dir: "./test/inputnew/example"},
+		"import path":           {target: "github.com/fastbill/go-mock-gen/test/inputnew/example", name: "Exampler", dir: "test/inputnew/example"},
+		"import path and name":  {target: "github.com/fastbill/go-mock-gen/test/inputnew/example.Exampler", dir: "test/inputnew/example"},
+		"standard library":      {target: "io.ReadCloser", dir: localMocksDir},
+		"standard library name": {target: "io", name: "Writer", dir: localMocksDir},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			iface, dir, err := locateInterface(test.target, test.name)
+			require.NoError(t, err)
+			assert.Equal(t, test.dir, dir)
+			assert.NotEmpty(t, iface.Methods())
+		})
+	}
+
+	_, _, err := locateInterface("io", "")
+	assert.EqualError(t, err, "io is not of the form <importPath>.<interfaceName>")
+	_, _, err = locateInterface("io.Missing", "")
+	assert.EqualError(t, err, "Missing is not declared in package io: entity not found")
+}
+
+func TestQualifiedInterface(t *testing.T) {
+	assert.True(t, qualifiedInterface("io.ReadCloser"))
+	assert.True(t, qualifiedInterface("./test/inputnew/example.Exampler"))
+	assert.False(t, qualifiedInterface("./test/inputnew/example"))
+	assert.False(t, qualifiedInterface("./test/inputnew/example/types.go"))
+	assert.False(t, qualifiedInterface("./missing/package.Exampler"))
+	assert.False(t, qualifiedInterface("github.com/fastbill/go-mock-gen"))
+}
+
 func TestGenerateNewMock(t *testing.T) {
 	cleanup(t)
-	err := generateNewMock("./test/inputnew/example/types.go", "Exampler", "TestMock")
+	err := generateNewMock("./test/inputnew/example/types.go", "Exampler", "TestMock", newOptions{receiverName: defaultReceiverName})
 	require.NoError(t, err)
 	expected, err := ioutil.ReadFile("./test/expectednew/result.go")
 	require.NoError(t, err, "error in test setup")
@@ -31,13 +70,35 @@ func TestGenerateNewMock(t *testing.T) {
 	assert.Equal(t, string(expected), string(actual))
 }
 
+func TestGenerateMockWithReceiverName(t *testing.T) {
+	iface, err := findInterface("./test/inputnew/example/types.go", "Exampler")
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	err = generateMock(iface, mockPackage{name: "examplemock"}, "TestMock", "mk", false, buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "func (mk *TestMock) FunctionA(user *model.StructA) (string, error) {\n\targs := mk.Called(user)\n")
+	assert.NotContains(t, buf.String(), "(m *TestMock)")
+}
+
 func TestUpdateMock(t *testing.T) {
 	cleanup(t)
 	err := copy.Copy("./test/inputfix/existing", "./test/inputfix/example/examplemock")
 	require.NoError(t, err, "error in test setup")
 
-	err = updateMock("./test/inputfix/example/types.go", "Exampler")
+	report, err := updateMock("./test/inputfix/example/types.go", "Exampler", updateOptions{strategy: strategyRegenerate})
 	require.NoError(t, err)
+	assert.Equal(t, &changeReport{
+		Mock:           "test/inputfix/example/examplemock/testmock.go",
+		Interface:      "github.com/fastbill/go-mock-gen/test/inputfix/example.Exampler",
+		Added:          []string{"FunctionD"},
+		Removed:        []string{"FunctionA"},
+		Regenerated:    []string{"FunctionC"},
+		Kept:           []keptMethod{{Name: "FunctionZ", Reason: keptUnchanged}},
+		Orphaned:       []string{},
+		DirectiveAdded: true,
+		Warnings:       []string{},
+	}, report)
 
 	expected, err := ioutil.ReadFile("./test/expectedfix/result.go")
 	require.NoError(t, err, "error in test setup")
@@ -46,6 +107,36 @@ func TestUpdateMock(t *testing.T) {
 	assert.Equal(t, string(expected), string(actual))
 }
 
+func TestReadExistingFiles(t *testing.T) {
+	iface, err := findInterface("./test/inputfix/example/types.go", "Exampler")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	mockDir := filepath.Join(dir, "examplemock")
+	require.NoError(t, os.Mkdir(mockDir, os.ModePerm), "error in test setup")
+	write := func(name, content string) {
+		err := ioutil.WriteFile(filepath.Join(mockDir, name), []byte(content), os.ModePerm)
+		require.NoError(t, err, "error in test setup")
+	}
+
+	directive := "//mockgen:interface github.com/fastbill/go-mock-gen/test/inputfix/example.Exampler struct=ExamplerMock\n"
+	write("example.go", "// ExampleMock is a mock implementation of the example.Example interface.\n"+
+		"//mockgen:interface github.com/fastbill/go-mock-gen/test/inputfix/example.Example struct=ExampleMock\n"+
+		"// It is not a mock of example.Exampler.\n")
+	write("legacy.go", "// TestMock is a mock implementation of the example.Exampler interface.\n")
+	write("exampler.go", "// ExamplerMock is a mock implementation of the example.Exampler interface.\n"+directive)
+
+	mock, err := readExistingFiles(mockDir, iface, true)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(mockDir, "exampler.go"), mock.path)
+	assert.Equal(t, "ExamplerMock", mock.structName)
+
+	write("other.go", directive)
+	_, err = readExistingFiles(mockDir, iface, true)
+	assert.EqualError(t, err, "found 2 mocks for interface github.com/fastbill/go-mock-gen/test/inputfix/example.Exampler, there must only be one: "+
+		filepath.Join(mockDir, "exampler.go")+", "+filepath.Join(mockDir, "other.go"))
+}
+
 func cleanup(t *testing.T) {
 	err := os.RemoveAll("./test/inputnew/example/examplemock")
 	assert.NoError(t, err, "error in test setup")
@@ -53,3 +144,150 @@ func cleanup(t *testing.T) {
 	err = os.RemoveAll("./test/inputfix/example/examplemock")
 	assert.NoError(t, err, "error in test setup")
 }
+
+func TestConstraintInterface(t *testing.T) {
+	_, err := findInterface("./test/generic/generic.go", "Number")
+	assert.EqualError(t, err, "Number is a constraint and can not be mocked")
+
+	pkg, err := loadPackage("./test/generic")
+	require.NoError(t, err)
+	names := []string{}
+	for _, iface := range packageInterfaces(pkg.Types) {
+		names = append(names, iface.Name)
+	}
+	assert.Equal(t, []string{"Cache", "Feed", "Handler", "Repository"}, names)
+}
+
+func TestGenerateGenericMock(t *testing.T) {
+	t.Cleanup(func() { _ = os.RemoveAll("./test/generic/genericmock") })
+	err := generateNewMock("./test/generic/generic.go", "Repository", "RepositoryMock", newOptions{receiverName: defaultReceiverName})
+	require.NoError(t, err)
+	expected, err := ioutil.ReadFile("./test/expectedgeneric/result.go")
+	require.NoError(t, err, "error in test setup")
+	actual, err := ioutil.ReadFile("./test/generic/genericmock/repositorymock.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+
+	iface, err := findInterface("./test/generic/generic.go", "Cache")
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	err = generateMock(iface, mockPackage{name: "genericmock"}, "CacheMock", "m", false, buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "type CacheMock[K comparable, V generic.Number] struct {")
+	assert.Contains(t, buf.String(), "func (m *CacheMock[K, V]) Set(key K, value V) {")
+	assert.Contains(t, buf.String(), "return *new(V), args.Bool(1)")
+
+	// Type parameters are declared again by every method, so the methods are still recognized as unchanged.
+	report, err := updateMock("./test/generic/generic.go", "Repository", updateOptions{strategy: strategyRegenerate})
+	require.NoError(t, err)
+	assert.Empty(t, report.Regenerated)
+	assert.Len(t, report.Kept, 3)
+}
+
+func TestGenerateMockWithTypeArguments(t *testing.T) {
+	iface, err := findInterface("./test/generic/instantiated.go", "Feed")
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	err = generateMock(iface, mockPackage{name: "genericmock"}, "FeedMock", defaultReceiverName, false, buf)
+	require.NoError(t, err)
+	expected, err := ioutil.ReadFile("./test/expectedgeneric/feed.go")
+	require.NoError(t, err, "error in test setup")
+	assert.Equal(t, string(expected), buf.String())
+}
+
+func TestGenerateInstantiatedMock(t *testing.T) {
+	iface, err := findInterface("./test/generic/instantiated.go", "Feed[ *model.StructA ]")
+	require.NoError(t, err)
+	assert.Equal(t, "github.com/fastbill/go-mock-gen/test/generic.Feed[*model.StructA]", interfaceID(iface))
+
+	buf := &bytes.Buffer{}
+	err = generateMock(iface, mockPackage{name: "genericmock"}, "ModelFeed", defaultReceiverName, false, buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "//mockgen:interface github.com/fastbill/go-mock-gen/test/generic.Feed[*model.StructA] struct=ModelFeed\ntype ModelFeed struct {")
+	assert.Contains(t, buf.String(), "func (m *ModelFeed) Swap(value *atomic.Pointer[*model.StructA]) generic.Handler[generic.Page[*model.StructA]] {")
+	assert.Equal(t, []mockDirective{{Interface: interfaceID(iface), StructName: "ModelFeed"}}, parseDirectives(buf.String()))
+
+	// Types of the package of the interface are used without package name.
+	iface, err = findInterface("./test/generic/instantiated.go", "Feed[Event]")
+	require.NoError(t, err)
+	buf.Reset()
+	err = generateMock(iface, mockPackage{name: "genericmock"}, "EventFeed", defaultReceiverName, false, buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "func (m *EventFeed) Swap(value *atomic.Pointer[generic.Event]) generic.Handler[generic.Page[generic.Event]] {")
+
+	for name, msg := range map[string]string{
+		"Cache[string]":                 "failed to instantiate Cache: ",
+		"Cache[string, *model.StructA]": "failed to instantiate Cache: ",
+		"Cache[string, unknown.Type]":   "failed to resolve type argument unknown.Type of Cache: ",
+		"Number[int]":                   "Number is not generic and can not be instantiated",
+		"Cache[string":                  "Cache[string is not a valid instantiation of a generic type",
+	} {
+		_, err := findInterface("./test/generic/generic.go", name)
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), msg, name)
+		}
+	}
+}
+
+func TestSplitQualifiedName(t *testing.T) {
+	target, name, ok := splitQualifiedName("github.com/org/generic.Cache[string, *model.Session]")
+	assert.True(t, ok)
+	assert.Equal(t, "github.com/org/generic", target)
+	assert.Equal(t, "Cache[string, *model.Session]", name)
+
+	target, name, ok = splitQualifiedName("net/http.RoundTripper")
+	assert.True(t, ok)
+	assert.Equal(t, "net/http", target)
+	assert.Equal(t, "RoundTripper", name)
+
+	_, _, ok = splitQualifiedName("Cache[string, *model.Session]")
+	assert.False(t, ok)
+}
+
+func TestGenerateMockWithAnonymousTypes(t *testing.T) {
+	iface, err := findInterface("./test/anonymous/anonymous.go", "Service")
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	err = generateMock(iface, mockPackage{name: "anonymousmock"}, "ServiceMock", defaultReceiverName, false, buf)
+	require.NoError(t, err)
+	expected, err := ioutil.ReadFile("./test/expectedanonymous/result.go")
+	require.NoError(t, err, "error in test setup")
+	assert.Equal(t, string(expected), buf.String())
+
+	iface, err = findInterface("./test/anonymous/anonymous.go", "Hidden")
+	require.NoError(t, err)
+	err = generateMock(iface, mockPackage{name: "anonymousmock"}, "HiddenMock", defaultReceiverName, false, &bytes.Buffer{})
+	assert.EqualError(t, err, "the unexported field secret of an anonymous type in github.com/fastbill/go-mock-gen/test/anonymous can only be used in its own package, generate the mock in the package of the interface")
+
+	buf.Reset()
+	err = generateMock(iface, mockPackage{name: "anonymous", local: true}, "HiddenMock", defaultReceiverName, false, buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "func (m *HiddenMock) Use(options struct {\n\tsecret string\n}) {")
+}
+
+func TestGenerateMockWithAliases(t *testing.T) {
+	iface, err := findInterface("./test/alias/alias.go", "Directory")
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	err = generateMock(iface, mockPackage{name: "aliasmock"}, "DirectoryMock", defaultReceiverName, false, buf)
+	require.NoError(t, err)
+	expected, err := ioutil.ReadFile("./test/expectedalias/result.go")
+	require.NoError(t, err, "error in test setup")
+	assert.Equal(t, string(expected), buf.String())
+
+	buf.Reset()
+	err = generateMock(iface, mockPackage{name: "aliasmock"}, "DirectoryMock", defaultReceiverName, true, buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "func (m *DirectoryMock) Lookup(id ids.ID, key string) (map[ids.ID][]*model.StructA, error) {")
+	assert.Contains(t, buf.String(), "func (m *DirectoryMock) Any(value any) any {")
+
+	// The unexported alias can be used by a mock in the package of the interface.
+	buf.Reset()
+	err = generateMock(iface, mockPackage{name: "alias", local: true}, "DirectoryMock", defaultReceiverName, false, buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "func (m *DirectoryMock) Lookup(id UserID, key ids.Key) (Users, error) {")
+	assert.Contains(t, buf.String(), "func (m *DirectoryMock) Hidden(key userKey) []userKey {")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Output formats of the change report.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// Reasons why the existing implementation of a method was kept.
+const (
+	keptUnchanged  = "unchanged"  // The signature did not change.
+	keptCustomized = "customized" // The signature changed but the customized body was kept, rewritten or edited.
+)
+
+// changeReport summarizes what an update did to the methods of a mock.
+type changeReport struct {
+	Mock           string       `json:"mock"`      // Path of the mock file.
+	Interface      string       `json:"interface"` // Import path and name of the interface.
+	Created        bool         `json:"created"`   // The mock did not exist before, all its methods are added.
+	Added          []string     `json:"added"`
+	Removed        []string     `json:"removed"`
+	Regenerated    []string     `json:"regenerated"` // Methods that were replaced because their signature changed.
+	Kept           []keptMethod `json:"kept"`
+	Orphaned       []string     `json:"orphaned"`       // Methods of the mock struct that were not generated for the interface, they are kept.
+	DirectiveAdded bool         `json:"directiveAdded"` // The mockgen:interface directive was missing and is added.
+	Warnings       []string     `json:"warnings"`
+}
+
+// keptMethod is a method whose existing implementation was kept.
+type keptMethod struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func newChangeReport() *changeReport {
+	return &changeReport{Added: []string{}, Removed: []string{}, Regenerated: []string{}, Kept: []keptMethod{}, Orphaned: []string{}, Warnings: []string{}}
+}
+
+func (r *changeReport) keep(name, reason string) {
+	r.Kept = append(r.Kept, keptMethod{Name: name, Reason: reason})
+}
+
+// writeText writes the report in a human-readable form.
+func (r *changeReport) writeText(out io.Writer) error {
+	kept := []string{}
+	for _, method := range r.Kept {
+		kept = append(kept, method.Name+" ("+method.Reason+")")
+	}
+
+	lines := []string{fmt.Sprintf("%s (%s)", r.Mock, r.Interface)}
+	if r.Created {
+		lines[0] += " created"
+	}
+	for _, group := range []struct {
+		title   string
+		methods []string
+	}{
+		{"added", r.Added},
+		{"removed", r.Removed},
+		{"regenerated", r.Regenerated},
+		{"kept", kept},
+		{"orphaned", r.Orphaned},
+	} {
+		if len(group.methods) > 0 {
+			lines = append(lines, fmt.Sprintf("  %-12s %s", group.title+":", strings.Join(group.methods, ", ")))
+		}
+	}
+	if r.DirectiveAdded {
+		lines = append(lines, "  directive:   mockgen:interface added")
+	}
+	for _, warning := range r.Warnings {
+		lines = append(lines, "  Warning: "+warning)
+	}
+
+	_, err := fmt.Fprintln(out, strings.Join(lines, "\n"))
+	return errors.Wrap(err, "failed to write report")
+}
+
+// writeReports writes the reports in the given format. JSON is always written as an array so the
+// output has the same structure no matter how many mocks were updated.
+func writeReports(out io.Writer, reports []*changeReport, format string) error {
+	switch format {
+	case formatText:
+		for _, report := range reports {
+			err := report.writeText(out)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return errors.Wrap(encoder.Encode(reports), "failed to write report")
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteReports(t *testing.T) {
+	report := newChangeReport()
+	report.Mock = "pkg/examplemock/testmock.go"
+	report.Interface = "github.com/some-path/example.Exampler"
+	report.Added = []string{"FunctionD"}
+	report.Regenerated = []string{"FunctionC"}
+	report.keep("FunctionZ", keptUnchanged)
+	report.keep("FunctionA", keptCustomized)
+	report.DirectiveAdded = true
+	report.Warnings = []string{"FunctionC could not be rewritten safely and was regenerated instead: reason"}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeReports(buf, []*changeReport{report}, formatText))
+	assert.Equal(t, `pkg/examplemock/testmock.go (github.com/some-path/example.Exampler)
+  added:       FunctionD
+  regenerated: FunctionC
+  kept:        FunctionZ (unchanged), FunctionA (customized)
+  directive:   mockgen:interface added
+  Warning: FunctionC could not be rewritten safely and was regenerated instead: reason
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeReports(buf, []*changeReport{report}, formatJSON))
+	assert.JSONEq(t, `[{
+		"mock": "pkg/examplemock/testmock.go",
+		"interface": "github.com/some-path/example.Exampler",
+		"created": false,
+		"added": ["FunctionD"],
+		"removed": [],
+		"regenerated": ["FunctionC"],
+		"kept": [{"name": "FunctionZ", "reason": "unchanged"}, {"name": "FunctionA", "reason": "customized"}],
+		"orphaned": [],
+		"directiveAdded": true,
+		"warnings": ["FunctionC could not be rewritten safely and was regenerated instead: reason"]
+	}]`, buf.String())
+
+	assert.EqualError(t, writeReports(buf, nil, "xml"), `unknown format "xml"`)
+}
@@ -0,0 +1,672 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// accessorNames are the methods of mock.Arguments that read a result by its index.
+var accessorNames = map[string]bool{"Get": true, "String": true, "Error": true, "Int": true, "Bool": true}
+
+// textEdit replaces the source code between two offsets of the existing file.
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// accessor is a call like args.Get(1) that reads a result of the Called invocation.
+type accessor struct {
+	call  *ast.CallExpr
+	index int
+}
+
+// methodRewriter adapts an existing method to the changed signature of the generated one.
+// Only the mechanical parts are changed: the parameter list, the arguments of Called, the
+// indices used to read the results of Called and the return statements.
+type methodRewriter struct {
+	existing  *mockSource
+	fn        *ast.FuncDecl
+	generated *mockSource
+	newFn     *ast.FuncDecl
+
+	oldSig, newSig *types.Signature
+	called         *ast.CallExpr     // The Called invocation of the existing method.
+	argsAssign     *ast.AssignStmt   // The statement that assigns the result of Called, if any.
+	argsVar        types.Object      // The variable the result of Called is assigned to, if any.
+	accessors      []accessor        // All reads of results of Called.
+	returns        []*ast.ReturnStmt // All return statements of the method itself.
+
+	edits []textEdit
+}
+
+// rewriteMethod returns the source code of the existing method adapted to the signature of the generated
+// one. An error describing the reason is returned if the method can not be rewritten safely.
+func rewriteMethod(existing *mockSource, existingFn *ast.FuncDecl, generated *mockSource, newFn *ast.FuncDecl) (string, error) {
+	rw := &methodRewriter{existing: existing, fn: existingFn, generated: generated, newFn: newFn}
+	rw.oldSig, rw.newSig = existing.typeOf(existingFn), generated.typeOf(newFn)
+	if rw.oldSig == nil || rw.newSig == nil {
+		return "", errors.New("the types in the signature could not be resolved")
+	}
+	if existingFn.Body == nil {
+		return "", errors.New("the method has no body")
+	}
+
+	var err error
+	rw.called, err = findCalled(existingFn)
+	if err != nil {
+		return "", err
+	}
+	rw.inspectBody()
+
+	err = rw.rewriteParams()
+	if err != nil {
+		return "", err
+	}
+	err = rw.rewriteResults()
+	if err != nil {
+		return "", err
+	}
+
+	return rw.apply()
+}
+
+// findCalled returns the only invocation of Called on the receiver of the method.
+func findCalled(fn *ast.FuncDecl) (*ast.CallExpr, error) {
+	names := fn.Recv.List[0].Names
+	if len(names) != 1 {
+		return nil, errors.New("the receiver has no name")
+	}
+
+	calls := []*ast.CallExpr{}
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if ok && sel.Sel.Name == "Called" && isIdent(sel.X, names[0].Name) {
+			calls = append(calls, call)
+		}
+		return true
+	})
+
+	if len(calls) != 1 {
+		return nil, fmt.Errorf("expected exactly one call of %s.Called but found %d", names[0].Name, len(calls))
+	}
+	return calls[0], nil
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+// inspectBody collects the assignment of the result of Called, all reads of results and all return statements.
+func (rw *methodRewriter) inspectBody() {
+	ast.Inspect(rw.fn.Body, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FuncLit:
+			// Return statements of closures do not belong to the method.
+			ast.Inspect(n.Body, rw.inspectAccessor)
+			return false
+		case *ast.ReturnStmt:
+			rw.returns = append(rw.returns, n)
+		case *ast.AssignStmt:
+			if len(n.Lhs) == 1 && len(n.Rhs) == 1 && n.Rhs[0] == rw.called {
+				if ident, ok := n.Lhs[0].(*ast.Ident); ok {
+					rw.argsAssign = n
+					rw.argsVar = rw.existing.objectOf(ident)
+				}
+			}
+		}
+		return rw.inspectAccessor(node)
+	})
+}
+
+func (rw *methodRewriter) inspectAccessor(node ast.Node) bool {
+	call, ok := node.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return true
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || !accessorNames[sel.Sel.Name] || !rw.isArguments(sel.X) {
+		return true
+	}
+
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.INT {
+		return true
+	}
+	var index int
+	_, err := fmt.Sscanf(lit.Value, "%d", &index)
+	if err == nil {
+		rw.accessors = append(rw.accessors, accessor{call: call, index: index})
+	}
+	return true
+}
+
+// isArguments reports whether the expression is the result of Called.
+func (rw *methodRewriter) isArguments(expr ast.Expr) bool {
+	if expr == rw.called {
+		return true
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	obj := rw.existing.objectOf(ident)
+	return obj != nil && obj == rw.argsVar
+}
+
+// rewriteParams replaces the parameter list and the arguments of Called. That is only safe if the
+// arguments of Called were not customized and the body does not use parameters that were removed.
+func (rw *methodRewriter) rewriteParams() error {
+	oldParams, newParams := rw.oldSig.Params(), rw.newSig.Params()
+	if identicalTuples(oldParams, newParams) && rw.oldSig.Variadic() == rw.newSig.Variadic() {
+		return nil
+	}
+	if rw.oldSig.Variadic() || rw.newSig.Variadic() {
+		return errors.New("the variadic parameters changed")
+	}
+
+	if len(rw.called.Args) != oldParams.Len() {
+		return errors.New("the arguments of Called were customized")
+	}
+	for i, arg := range rw.called.Args {
+		ident, ok := arg.(*ast.Ident)
+		if !ok || rw.existing.objectOf(ident) != oldParams.At(i) {
+			return errors.New("the arguments of Called were customized")
+		}
+	}
+
+	var err error
+	ast.Inspect(rw.fn.Body, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Ident)
+		if !ok || err != nil || (ident.Pos() >= rw.called.Lparen && ident.End() <= rw.called.Rparen) {
+			return err == nil
+		}
+		param := tupleVar(oldParams, rw.existing.objectOf(ident))
+		if param != nil && !hasVar(newParams, param) {
+			err = fmt.Errorf("the parameter %s is used in the body but was removed or changed its type", param.Name())
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// A new parameter would shadow or conflict with what the body declares or refers to by the same name.
+	oldNames := map[string]bool{}
+	for i := 0; i < oldParams.Len(); i++ {
+		oldNames[oldParams.At(i).Name()] = true
+	}
+	for i := 0; i < newParams.Len(); i++ {
+		name := newParams.At(i).Name()
+		if name != "" && name != "_" && !oldNames[name] && rw.usesName(name) {
+			return fmt.Errorf("the name of the new parameter %s is already used in the body", name)
+		}
+	}
+
+	newCalled, err := findCalled(rw.newFn)
+	if err != nil {
+		return err
+	}
+
+	rw.replace(rw.fn.Type.Params.Pos(), rw.fn.Type.Params.End(), rw.generatedFields(rw.newFn.Type.Params))
+	rw.replace(rw.called.Lparen+1, rw.called.Rparen, rw.generatedExprs(newCalled.Args))
+	return nil
+}
+
+// usesName reports whether the body declares or refers to a variable, constant, type, function or package
+// with the given name.
+func (rw *methodRewriter) usesName(name string) bool {
+	used := false
+	ast.Inspect(rw.fn.Body, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Ident)
+		if ok && ident.Name == name {
+			// Fields and methods have no parent scope, they are not affected by parameters.
+			obj := rw.existing.objectOf(ident)
+			used = obj != nil && obj.Parent() != nil
+		}
+		return !used
+	})
+	return used
+}
+
+// rewriteResults replaces the result list, moves the indices used to read the results of Called and inserts
+// or removes values in all return statements. That is only safe if removed results are not used in a
+// customized way and inserted results can not be nil.
+// nolint: gocyclo
+func (rw *methodRewriter) rewriteResults() error {
+	oldResults, newResults := rw.oldSig.Results(), rw.newSig.Results()
+	if identicalTuples(oldResults, newResults) {
+		return nil
+	}
+	if oldResults.Len() == 0 {
+		return errors.New("results were added to a method without results")
+	}
+
+	mapping := alignTuples(oldResults, newResults)
+	inserted := map[int]bool{}
+	for j := 0; j < newResults.Len(); j++ {
+		inserted[j] = true
+	}
+	for _, j := range mapping {
+		delete(inserted, j)
+	}
+	for j := range inserted {
+		typ := newResults.At(j).Type()
+		if (isNillable(typ) || isTypeParam(typ)) && !types.Identical(typ, types.Universe.Lookup("error").Type()) {
+			return fmt.Errorf("the new result %d can be nil and needs a custom implementation", j)
+		}
+	}
+	if len(inserted) > 0 && rw.argsVar == nil {
+		return errors.New("the result of Called is not assigned to a variable")
+	}
+
+	removed := []ast.Expr{}
+	for _, ret := range rw.returns {
+		if len(ret.Results) != oldResults.Len() {
+			return fmt.Errorf("the return statement in line %d can not be rewritten", rw.existing.fset.Position(ret.Pos()).Line)
+		}
+		for i, expr := range ret.Results {
+			if mapping[i] != -1 {
+				continue
+			}
+			if !rw.removable(expr, i) {
+				return fmt.Errorf("the removed result %d is used in a customized way", i)
+			}
+			removed = append(removed, expr)
+		}
+	}
+
+	accessorEdits := []textEdit{}
+	remainingReads := 0
+	for _, acc := range rw.accessors {
+		if acc.index >= len(mapping) {
+			return fmt.Errorf("result %d is read but the method only had %d results", acc.index, len(mapping))
+		}
+		if mapping[acc.index] == -1 {
+			if !containedIn(acc.call, removed) {
+				return fmt.Errorf("the removed result %d is still used", acc.index)
+			}
+			continue
+		}
+		remainingReads++
+		if mapping[acc.index] != acc.index {
+			lit := acc.call.Args[0]
+			accessorEdits = append(accessorEdits, rw.edit(lit.Pos(), lit.End(), fmt.Sprint(mapping[acc.index])))
+		}
+	}
+	if err := rw.checkArgumentsUsage(); err != nil {
+		return err
+	}
+
+	// Changes inside of return statements become part of the new return values.
+	inner := append(rw.edits, accessorEdits...)
+	rw.edits = nil
+	for _, e := range inner {
+		if !rw.insideReturn(e) {
+			rw.edits = append(rw.edits, e)
+		}
+	}
+	rw.replaceResultList()
+	for _, ret := range rw.returns {
+		rw.rewriteReturn(ret, mapping, inner)
+	}
+
+	// The variable holding the result of Called would be unused otherwise.
+	if rw.argsAssign != nil && remainingReads == 0 && len(inserted) == 0 {
+		rw.replace(rw.argsAssign.Pos(), rw.called.Pos(), "")
+	}
+	return nil
+}
+
+// checkArgumentsUsage makes sure that the result of Called is only used to read results by a constant index.
+func (rw *methodRewriter) checkArgumentsUsage() error {
+	if rw.argsVar == nil {
+		return nil
+	}
+
+	var err error
+	ast.Inspect(rw.fn.Body, func(node ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		ident, ok := node.(*ast.Ident)
+		if !ok || rw.existing.objectOf(ident) != rw.argsVar || (rw.argsAssign != nil && ident == rw.argsAssign.Lhs[0]) {
+			return true
+		}
+		for _, acc := range rw.accessors {
+			if acc.call.Fun.(*ast.SelectorExpr).X == ident {
+				return true
+			}
+		}
+		err = fmt.Errorf("%s is used in a way that can not be rewritten", ident.Name)
+		return false
+	})
+	return err
+}
+
+// removable reports whether the value returned for the removed result at the given index can be dropped
+// without losing custom logic.
+func (rw *methodRewriter) removable(expr ast.Expr, index int) bool {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.Ident:
+		_, ok := rw.existing.objectOf(e).(*types.Nil)
+		_, isConst := rw.existing.objectOf(e).(*types.Const)
+		return ok || isConst
+	case *ast.TypeAssertExpr:
+		return rw.removable(e.X, index)
+	case *ast.CallExpr:
+		for _, acc := range rw.accessors {
+			if acc.call == e {
+				return acc.index == index
+			}
+		}
+	}
+	return false
+}
+
+func containedIn(node ast.Node, exprs []ast.Expr) bool {
+	for _, expr := range exprs {
+		if node.Pos() >= expr.Pos() && node.End() <= expr.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceResultList replaces the results in the signature with the ones of the generated method.
+func (rw *methodRewriter) replaceResultList() {
+	oldList, newList := rw.fn.Type.Results, rw.newFn.Type.Results
+	switch {
+	case newList == nil:
+		rw.replace(rw.fn.Type.Params.End(), oldList.End(), "")
+	case oldList == nil:
+		rw.replace(rw.fn.Type.Params.End(), rw.fn.Type.Params.End(), " "+rw.generatedFields(newList))
+	default:
+		rw.replace(oldList.Pos(), oldList.End(), rw.generatedFields(newList))
+	}
+}
+
+// rewriteReturn builds the new list of return values. Values of results that still exist are kept with their
+// indices adjusted, values for new results are read from the result of Called.
+func (rw *methodRewriter) rewriteReturn(ret *ast.ReturnStmt, mapping []int, edits []textEdit) {
+	newResults := rw.newSig.Results()
+	values := make([]string, newResults.Len())
+	for i, expr := range ret.Results {
+		if mapping[i] != -1 {
+			values[mapping[i]] = rw.textWithEdits(expr.Pos(), expr.End(), edits)
+		}
+	}
+	for j := range values {
+		if values[j] == "" {
+			values[j] = rw.readResult(j)
+		}
+	}
+
+	list := strings.Join(values, ", ")
+	if len(values) > 0 {
+		list = " " + list
+	}
+	rw.replace(ret.Return+token.Pos(len("return")), ret.End(), list)
+}
+
+// readResult returns the expression that reads the new result with the given index the same way the
+// generator does it.
+func (rw *methodRewriter) readResult(index int) string {
+	typ := rw.resultTypeText(index)
+	if representationMap[typ] != "" {
+		return fmt.Sprintf("%s.%s(%d)", rw.argsVar.Name(), representationMap[typ], index)
+	}
+	return fmt.Sprintf("%s.Get(%d).(%s)", rw.argsVar.Name(), index, typ)
+}
+
+func (rw *methodRewriter) resultTypeText(index int) string {
+	i := 0
+	for _, field := range rw.newFn.Type.Results.List {
+		count := len(field.Names)
+		if count == 0 {
+			count = 1
+		}
+		if index < i+count {
+			return rw.generatedExprs([]ast.Expr{field.Type})
+		}
+		i += count
+	}
+	return ""
+}
+
+// generatedFields renders a parameter or result list of the generated method. The code is printed from the AST
+// instead of copied from the source, because the package names in it may have been changed to the ones that
+// the existing mock imports.
+func (rw *methodRewriter) generatedFields(list *ast.FieldList) string {
+	fields := make([]string, 0, len(list.List))
+	for _, field := range list.List {
+		names := make([]string, 0, len(field.Names))
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		typ := rw.generatedExprs([]ast.Expr{field.Type})
+		if len(names) > 0 {
+			typ = strings.Join(names, ", ") + " " + typ
+		}
+		fields = append(fields, typ)
+	}
+
+	text := strings.Join(fields, ", ")
+	if list.Opening.IsValid() {
+		text = "(" + text + ")"
+	}
+	return text
+}
+
+// generatedExprs renders a list of expressions of the generated method separated by commas.
+func (rw *methodRewriter) generatedExprs(exprs []ast.Expr) string {
+	texts := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		buf := &bytes.Buffer{}
+		_ = printer.Fprint(buf, rw.generated.fset, expr)
+		texts = append(texts, buf.String())
+	}
+	return strings.Join(texts, ", ")
+}
+
+func (rw *methodRewriter) insideReturn(e textEdit) bool {
+	for _, ret := range rw.returns {
+		if e.start >= rw.offset(ret.Pos()) && e.end <= rw.offset(ret.End()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rw *methodRewriter) offset(pos token.Pos) int {
+	return rw.existing.fset.Position(pos).Offset
+}
+
+func (rw *methodRewriter) edit(start, end token.Pos, text string) textEdit {
+	return textEdit{start: rw.offset(start), end: rw.offset(end), text: text}
+}
+
+func (rw *methodRewriter) replace(start, end token.Pos, text string) {
+	rw.edits = append(rw.edits, rw.edit(start, end, text))
+}
+
+// textWithEdits returns the source code between the two positions with all edits inside of it applied.
+func (rw *methodRewriter) textWithEdits(start, end token.Pos, edits []textEdit) string {
+	from, to := rw.offset(start), rw.offset(end)
+	inside := []textEdit{}
+	for _, e := range edits {
+		if e.start >= from && e.end <= to {
+			inside = append(inside, e)
+		}
+	}
+
+	text, _ := applyEdits(rw.existing.src, from, to, inside)
+	return text
+}
+
+// apply applies all edits to the method and makes sure the result is still valid Go code.
+func (rw *methodRewriter) apply() (string, error) {
+	start, end := nodeRange(rw.fn)
+	text, err := applyEdits(rw.existing.src, rw.offset(start), rw.offset(end), rw.edits)
+	if err != nil {
+		return "", err
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	_, err = parser.ParseFile(token.NewFileSet(), "", "package p\n\n"+text, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("the rewritten method is invalid: %w", err)
+	}
+	err = rw.typeCheck(text)
+	if err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+// typeCheck type checks the existing mock with the rewritten method in place. The mock does not need to
+// compile as a whole, so only type errors in the method that the existing one did not have count.
+func (rw *methodRewriter) typeCheck(text string) error {
+	start, end := nodeRange(rw.fn)
+	from, to := rw.offset(start), rw.offset(end)
+	src := string(rw.existing.src[:from]) + text + string(rw.existing.src[to:])
+	rewritten, err := parseMock(rw.existing.name, src)
+	if err != nil {
+		return fmt.Errorf("the rewritten method is invalid: %w", err)
+	}
+
+	// The packages of new types in the signature are only imported by the merged mock.
+	for _, spec := range rw.existing.file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := ""
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		astutil.AddNamedImport(rewritten.fset, rewritten.file, name, path)
+	}
+	rewritten.typeCheck(rw.existing.importer)
+
+	known := map[string]int{}
+	for _, msg := range rw.existing.typeErrorsIn(from, to) {
+		known[msg]++
+	}
+	for _, msg := range rewritten.typeErrorsIn(from, from+len(text)) {
+		if known[msg] == 0 {
+			return fmt.Errorf("the rewritten method does not compile: %s", msg)
+		}
+		known[msg]--
+	}
+	return nil
+}
+
+func applyEdits(src []byte, from, to int, edits []textEdit) (string, error) {
+	sorted := append([]textEdit{}, edits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].start < sorted[j].start
+	})
+
+	builder := strings.Builder{}
+	pos := from
+	for _, e := range sorted {
+		if e.start < pos {
+			return "", errors.New("overlapping changes")
+		}
+		builder.Write(src[pos:e.start])
+		builder.WriteString(e.text)
+		pos = e.end
+	}
+	builder.Write(src[pos:to])
+	return builder.String(), nil
+}
+
+func identicalTuples(a, b *types.Tuple) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	for i := 0; i < a.Len(); i++ {
+		if !identicalTypes(a.At(i).Type(), b.At(i).Type()) {
+			return false
+		}
+	}
+	return true
+}
+
+// alignTuples maps every index of before to the index of the same type in after or to -1 if it was removed.
+// The mapping is based on the longest common subsequence of both type lists.
+func alignTuples(before, after *types.Tuple) []int {
+	n, m := before.Len(), after.Len()
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if identicalTypes(before.At(i).Type(), after.At(j).Type()) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	mapping := make([]int, n)
+	for i := range mapping {
+		mapping[i] = -1
+	}
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case identicalTypes(before.At(i).Type(), after.At(j).Type()):
+			mapping[i] = j
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return mapping
+}
+
+// tupleVar returns obj if it is one of the variables of the tuple.
+func tupleVar(tuple *types.Tuple, obj types.Object) *types.Var {
+	for i := 0; i < tuple.Len(); i++ {
+		if tuple.At(i) == obj {
+			return tuple.At(i)
+		}
+	}
+	return nil
+}
+
+// hasVar reports whether the tuple contains a variable with the same name and type.
+func hasVar(tuple *types.Tuple, v *types.Var) bool {
+	for i := 0; i < tuple.Len(); i++ {
+		if tuple.At(i).Name() == v.Name() && identicalTypes(tuple.At(i).Type(), v.Type()) {
+			return true
+		}
+	}
+	return false
+}
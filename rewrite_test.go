@@ -0,0 +1,426 @@
+package main
+
+import (
+	"go/token"
+	"go/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const rewritePreamble = `package examplemock
+
+import (
+	"github.com/some-path/model"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+`
+
+const rewritePreambleWithoutModel = `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+`
+
+const rewritePreambleGeneric = `package examplemock
+
+import "github.com/stretchr/testify/mock"
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock[T any] struct {
+	mock.Mock
+}
+`
+
+func TestRewriteMethod(t *testing.T) {
+	tests := map[string]struct {
+		preamble string
+		existing string
+		new      string
+		expected string
+		warnings []string
+	}{
+		"parameter added": {
+			existing: `
+// FunctionZ is a mock implementation of example.Exampler#FunctionZ.
+func (m *TestMock) FunctionZ(id int, user *model.StructA) (*model.StructB, *model.StructA, error) {
+	args := m.Called(id, user)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.StructB), nil, args.Error(2)
+	}
+
+	if args.Get(1) != nil {
+		return nil, args.Get(1).(*model.StructA), args.Error(2)
+	}
+
+	return nil, nil, args.Error(2)
+}
+`,
+			new: `
+// FunctionZ is a mock implementation of example.Exampler#FunctionZ.
+func (m *TestMock) FunctionZ(id int, user *model.StructA, force bool) (*model.StructB, *model.StructA, error) {
+	args := m.Called(id, user, force)
+
+	if args.Get(0) != nil && args.Get(1) != nil {
+		return args.Get(0).(*model.StructB), args.Get(1).(*model.StructA), args.Error(2)
+	}
+
+	return nil, nil, args.Error(2)
+}
+`,
+			expected: `
+// FunctionZ is a mock implementation of example.Exampler#FunctionZ.
+func (m *TestMock) FunctionZ(id int, user *model.StructA, force bool) (*model.StructB, *model.StructA, error) {
+	args := m.Called(id, user, force)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.StructB), nil, args.Error(2)
+	}
+
+	if args.Get(1) != nil {
+		return nil, args.Get(1).(*model.StructA), args.Error(2)
+	}
+
+	return nil, nil, args.Error(2)
+}
+`,
+		},
+		"result inserted": {
+			preamble: rewritePreambleWithoutModel,
+			existing: `
+// Find is a mock implementation of example.Exampler#Find.
+func (m *TestMock) Find(name string) (string, error) {
+	args := m.Called(name)
+
+	// Fall back to a default value.
+	if args.String(0) == "" {
+		return "default", args.Error(1)
+	}
+
+	return args.String(0), args.Error(1)
+}
+`,
+			new: `
+// Find is a mock implementation of example.Exampler#Find.
+func (m *TestMock) Find(name string) (string, int, error) {
+	args := m.Called(name)
+
+	return args.String(0), args.Int(1), args.Error(2)
+}
+`,
+			expected: `
+// Find is a mock implementation of example.Exampler#Find.
+func (m *TestMock) Find(name string) (string, int, error) {
+	args := m.Called(name)
+
+	// Fall back to a default value.
+	if args.String(0) == "" {
+		return "default", args.Int(1), args.Error(2)
+	}
+
+	return args.String(0), args.Int(1), args.Error(2)
+}
+`,
+		},
+		"result and parameter removed": {
+			preamble: rewritePreambleWithoutModel,
+			existing: `
+// Find is a mock implementation of example.Exampler#Find.
+func (m *TestMock) Find(name string, age int) (string, bool, error) {
+	args := m.Called(name, age)
+
+	result := func() string { return args.String(0) + "!" }
+
+	return result(), args.Bool(1), args.Error(2)
+}
+`,
+			new: `
+// Find is a mock implementation of example.Exampler#Find.
+func (m *TestMock) Find(name string) (string, error) {
+	args := m.Called(name)
+
+	return args.String(0), args.Error(1)
+}
+`,
+			expected: `
+// Find is a mock implementation of example.Exampler#Find.
+func (m *TestMock) Find(name string) (string, error) {
+	args := m.Called(name)
+
+	result := func() string { return args.String(0) + "!" }
+
+	return result(), args.Error(1)
+}
+`,
+		},
+		"removed result still used": {
+			existing: `
+// FunctionZ is a mock implementation of example.Exampler#FunctionZ.
+func (m *TestMock) FunctionZ(id int) (*model.StructB, *model.StructA, error) {
+	args := m.Called(id)
+
+	if args.Get(1) != nil {
+		return nil, args.Get(1).(*model.StructA), args.Error(2)
+	}
+
+	return nil, nil, args.Error(2)
+}
+`,
+			new: `
+// FunctionZ is a mock implementation of example.Exampler#FunctionZ.
+func (m *TestMock) FunctionZ(id int) (*model.StructB, error) {
+	args := m.Called(id)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.StructB), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+`,
+			expected: `
+// FunctionZ is a mock implementation of example.Exampler#FunctionZ.
+func (m *TestMock) FunctionZ(id int) (*model.StructB, error) {
+	args := m.Called(id)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.StructB), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+`,
+			warnings: []string{"FunctionZ could not be rewritten safely and was regenerated instead: the removed result 1 is still used"},
+		},
+		"removed parameter still used": {
+			existing: `
+// Save is a mock implementation of example.Exampler#Save.
+func (m *TestMock) Save(user *model.StructA, dryRun bool) error {
+	if dryRun {
+		return nil
+	}
+
+	return m.Called(user, dryRun).Error(0)
+}
+`,
+			new: `
+// Save is a mock implementation of example.Exampler#Save.
+func (m *TestMock) Save(user *model.StructA) error {
+	args := m.Called(user)
+
+	return args.Error(0)
+}
+`,
+			expected: `
+// Save is a mock implementation of example.Exampler#Save.
+func (m *TestMock) Save(user *model.StructA) error {
+	args := m.Called(user)
+
+	return args.Error(0)
+}
+`,
+			warnings: []string{"Save could not be rewritten safely and was regenerated instead: the parameter dryRun is used in the body but was removed or changed its type"},
+		},
+		"new parameter already declared in the body": {
+			preamble: rewritePreambleWithoutModel,
+			existing: `
+// Save is a mock implementation of example.Exampler#Save.
+func (m *TestMock) Save(name string) error {
+	args := m.Called(name)
+
+	note := "x"
+	if name == note {
+		return nil
+	}
+
+	return args.Error(0)
+}
+`,
+			new: `
+// Save is a mock implementation of example.Exampler#Save.
+func (m *TestMock) Save(name string, note string) error {
+	args := m.Called(name, note)
+
+	return args.Error(0)
+}
+`,
+			expected: `
+// Save is a mock implementation of example.Exampler#Save.
+func (m *TestMock) Save(name string, note string) error {
+	args := m.Called(name, note)
+
+	return args.Error(0)
+}
+`,
+			warnings: []string{"Save could not be rewritten safely and was regenerated instead: the name of the new parameter note is already used in the body"},
+		},
+		"type parameter result inserted": {
+			preamble: rewritePreambleGeneric,
+			existing: `
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock[T]) Get(id int) error {
+	args := m.Called(id)
+
+	return args.Error(0)
+}
+`,
+			new: `
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock[T]) Get(id int) (T, error) {
+	args := m.Called(id)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(T), args.Error(1)
+	}
+
+	return *new(T), args.Error(1)
+}
+`,
+			expected: `
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock[T]) Get(id int) (T, error) {
+	args := m.Called(id)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(T), args.Error(1)
+	}
+
+	return *new(T), args.Error(1)
+}
+`,
+			warnings: []string{"Get could not be rewritten safely and was regenerated instead: the new result 0 can be nil and needs a custom implementation"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			preamble := test.preamble
+			if preamble == "" {
+				preamble = rewritePreamble
+			}
+			existing, err := parseMock("existing.go", preamble+test.existing)
+			require.NoError(t, err)
+
+			result, err := calcResultMock(existing, preamble+test.new, "TestMock", modelImporter(), updateOptions{strategy: strategyRewrite})
+			require.NoError(t, err)
+			assert.Equal(t, preamble+test.expected, result.source)
+			assert.Equal(t, test.warnings, result.warnings)
+		})
+	}
+}
+
+func TestRewriteTypeCheck(t *testing.T) {
+	existing, err := parseMock("existing.go", rewritePreambleWithoutModel+`
+// Save is a mock implementation of example.Exampler#Save.
+func (m *TestMock) Save(name string) error {
+	return m.Called(name).Error(0)
+}
+`)
+	require.NoError(t, err)
+	existing.typeCheck(modelImporter())
+	rw := &methodRewriter{existing: existing, fn: existing.methods("TestMock")[0]}
+
+	err = rw.typeCheck(`// Save is a mock implementation of example.Exampler#Save.
+func (m *TestMock) Save(name string, note string) error {
+	return m.Called(name, note).Error(0)
+}`)
+	assert.NoError(t, err)
+
+	err = rw.typeCheck(`// Save is a mock implementation of example.Exampler#Save.
+func (m *TestMock) Save(name string, note string) error {
+	note := "x"
+	return m.Called(name, note).Error(0)
+}`)
+	assert.EqualError(t, err, "the rewritten method does not compile: no new variables on left side of :=")
+}
+
+func TestRewriteMethodWithAliasedImport(t *testing.T) {
+	existingMock := `package examplemock
+
+import (
+	ident "github.com/some-path/ids"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id ident.ID) error {
+	args := m.Called(id)
+
+	// Customized.
+	return args.Error(0)
+}
+`
+	newMock := `package examplemock
+
+import (
+	"github.com/some-path/ids"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id ids.ID, other ids.ID) (ids.ID, error) {
+	args := m.Called(id, other)
+
+	return args.Get(0).(ids.ID), args.Error(1)
+}
+`
+	expected := `package examplemock
+
+import (
+	ident "github.com/some-path/ids"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// TestMock is a mock implementation of the example.Exampler interface.
+type TestMock struct {
+	mock.Mock
+}
+
+// Get is a mock implementation of example.Exampler#Get.
+func (m *TestMock) Get(id ident.ID, other ident.ID) (ident.ID, error) {
+	args := m.Called(id, other)
+
+	// Customized.
+	return args.Get(0).(ident.ID), args.Error(1)
+}
+`
+
+	ids := types.NewPackage("github.com/some-path/ids", "ids")
+	obj := types.NewTypeName(token.NoPos, ids, "ID", nil)
+	types.NewNamed(obj, types.Typ[types.Int], nil)
+	ids.Scope().Insert(obj)
+	ids.MarkComplete()
+	importer := modelImporter()
+	importer[ids.Path()] = ids
+
+	existing, err := parseMock("existing.go", existingMock)
+	require.NoError(t, err)
+	result, err := calcResultMock(existing, newMock, "TestMock", importer, updateOptions{strategy: strategyRewrite})
+	require.NoError(t, err)
+	assert.Equal(t, expected, result.source)
+	assert.Empty(t, result.warnings)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is the config file that sync reads if no other file is given.
+const defaultConfigFile = ".go-mock-gen.yaml"
+
+// config is the content of the config file that lists all mocks of a repository, e.g.
+//
+//	defaults:
+//	  strategy: rewrite
+//	mocks:
+//	  - package: ./pkg/repository
+//	    interface: Persister
+//	    struct: Repository
+type config struct {
+	Defaults mockConfig   `yaml:"defaults"` // Layout, receiver, strategy and archive options that apply to all mocks unless they set their own.
+	Mocks    []mockConfig `yaml:"mocks"`
+}
+
+// mockConfig describes a single mock in the config file. Paths are relative to the config file.
+type mockConfig struct {
+	Package   string `yaml:"package"` // Directory of the package that declares the interface, a file in it or its import path.
+	Interface string `yaml:"interface"`
+	Struct    string `yaml:"struct"`      // Name of the mock struct, only needed to create the mock.
+	Output    string `yaml:"output"`      // Template of the folder of the mock, see layout.
+	MockPkg   string `yaml:"mockPackage"` // Template of the package name of the mock, see layout.
+	FileName  string `yaml:"fileName"`    // Template of the file name of the mock, see layout.
+	InPackage bool   `yaml:"inPackage"`   // Generate the mock in the package of the interface.
+	Test      string `yaml:"test"`        // Generate the mock in a _test.go file, internal or external.
+	Receiver  string `yaml:"receiver"`
+	Strategy  string `yaml:"strategy"`
+	Archive   string `yaml:"archive"`
+
+	ResolveAliases bool `yaml:"resolveAliases"` // Use the types that aliases stand for instead of the aliases.
+}
+
+// readConfig reads the config file and applies the defaults to all mocks.
+func readConfig(path string) (*config, error) {
+	// nolint: gosec
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read config")
+	}
+
+	cfg := &config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(blob))
+	decoder.KnownFields(true)
+	err = decoder.Decode(cfg)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to parse config "+path)
+	}
+	if len(cfg.Mocks) == 0 {
+		return nil, fmt.Errorf("config %s does not contain any mocks", path)
+	}
+
+	base := filepath.Dir(path)
+	for i := range cfg.Mocks {
+		mock := &cfg.Mocks[i]
+		if mock.Package == "" || mock.Interface == "" {
+			return nil, fmt.Errorf("mock %d in %s: package and interface are required", i+1, path)
+		}
+
+		if !qualifiedPackage(base, mock.Package) {
+			mock.Package = resolvePath(base, mock.Package)
+		}
+		mock.Output = firstNonEmpty(mock.Output, cfg.Defaults.Output)
+		// Templates that start with the directory of the interface are already relative to the working directory.
+		if mock.Output != "" && !strings.HasPrefix(mock.Output, "{{") {
+			mock.Output = resolvePath(base, mock.Output)
+		}
+		mock.MockPkg = firstNonEmpty(mock.MockPkg, cfg.Defaults.MockPkg)
+		mock.FileName = firstNonEmpty(mock.FileName, cfg.Defaults.FileName)
+		mock.InPackage = mock.InPackage || cfg.Defaults.InPackage
+		mock.Test = firstNonEmpty(mock.Test, cfg.Defaults.Test)
+		mock.Receiver = firstNonEmpty(mock.Receiver, cfg.Defaults.Receiver, defaultReceiverName)
+		mock.Strategy = firstNonEmpty(mock.Strategy, cfg.Defaults.Strategy, strategyRegenerate)
+		mock.Archive = firstNonEmpty(mock.Archive, cfg.Defaults.Archive)
+		mock.ResolveAliases = mock.ResolveAliases || cfg.Defaults.ResolveAliases
+		err = mock.updateOptions().validate()
+		if err == nil {
+			err = mock.newOptions().validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mock %d in %s: %w", i+1, path, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// resolvePath returns the path relative to the working directory if it is relative to the config file.
+func resolvePath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+// qualifiedPackage reports whether the package of a mock is given by its import path, e.g. net/http,
+// instead of a path relative to the config file.
+func qualifiedPackage(base, pkg string) bool {
+	if build.IsLocalImport(pkg) || filepath.IsAbs(pkg) {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(base, pkg))
+	return err != nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (m *mockConfig) String() string {
+	return m.Package + " " + m.Interface
+}
+
+func (m *mockConfig) layout() layout {
+	return layout{output: m.Output, pkg: m.MockPkg, file: m.FileName, inPackage: m.InPackage, test: m.Test}
+}
+
+func (m *mockConfig) newOptions() newOptions {
+	return newOptions{receiverName: m.Receiver, resolveAliases: m.ResolveAliases, layout: m.layout()}
+}
+
+func (m *mockConfig) updateOptions() updateOptions {
+	return updateOptions{strategy: m.Strategy, archive: m.Archive, layout: m.layout(), resolveAliases: m.ResolveAliases}
+}
+
+// planSync creates the mock if it does not exist yet and updates it otherwise, without writing anything.
+func planSync(m *mockConfig) (*mockUpdate, error) {
+	iface, dir, err := locateInterface(m.Package, m.Interface)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem finding interface")
+	}
+
+	_, err = m.layout().existingMock(dir, iface)
+	if err == nil {
+		return planInterfaceUpdate(dir, iface, m.updateOptions())
+	}
+	if !noMock(err) {
+		return nil, errors.Wrap(err, "failed to read existing file(s)")
+	}
+
+	if m.Struct == "" {
+		return nil, errors.New("the mock does not exist yet and no struct name is configured")
+	}
+	return planInterfaceMock(dir, iface, m.Struct, m.newOptions())
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), defaultConfigFile)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), os.ModePerm), "error in test setup")
+	return path
+}
+
+func TestReadConfig(t *testing.T) {
+	path := writeConfig(t, `
+defaults:
+  strategy: rewrite
+  receiver: mk
+  fileName: "{{snake .Struct}}.go"
+mocks:
+  - package: ./pkg/repository
+    interface: Persister
+    struct: Repository
+    output: ./mocks/repository
+  - package: /abs/pkg/gateway
+    interface: Gatewayer
+    strategy: regenerate
+    archive: section
+  - package: net/http
+    interface: RoundTripper
+`)
+
+	cfg, err := readConfig(path)
+	require.NoError(t, err)
+	base := filepath.Dir(path)
+	assert.Equal(t, []mockConfig{
+		{Package: filepath.Join(base, "pkg/repository"), Interface: "Persister", Struct: "Repository", Output: filepath.Join(base, "mocks/repository"), FileName: "{{snake .Struct}}.go", Receiver: "mk", Strategy: strategyRewrite},
+		{Package: "/abs/pkg/gateway", Interface: "Gatewayer", FileName: "{{snake .Struct}}.go", Receiver: "mk", Strategy: strategyRegenerate, Archive: archiveSection},
+		{Package: "net/http", Interface: "RoundTripper", FileName: "{{snake .Struct}}.go", Receiver: "mk", Strategy: strategyRewrite},
+	}, cfg.Mocks)
+
+	for content, expected := range map[string]string{
+		"mocks:\n  - package: ./pkg\n":                                    "mock 1 in " + path + ": package and interface are required",
+		"mocks:\n  - package: ./pkg\n    interface: I\n    strategy: x\n": "mock 1 in " + path + `: unknown update strategy "x"`,
+		"mocks:\n  - package: ./pkg\n    iface: I\n":                      "failed to parse config " + path + ": yaml: unmarshal errors:\n  line 3: field iface not found in type main.mockConfig",
+		"": "config " + path + " does not contain any mocks",
+	} {
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), os.ModePerm), "error in test setup")
+		_, err = readConfig(path)
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func TestSyncCommand(t *testing.T) {
+	cleanup(t)
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+	output := filepath.Join(t.TempDir(), "examplemock")
+
+	path := writeConfig(t, `
+mocks:
+  - package: `+filepath.Join(dir, "test/inputfix/example")+`
+    interface: Exampler
+  - package: `+filepath.Join(dir, "test/inputnew/example/types.go")+`
+    interface: Exampler
+    struct: ExamplerMock
+    output: `+output+`
+`)
+
+	code, _, stderr := runCLI("sync", "-config", path, "-dry-run")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stderr, "test/inputfix/example Exampler: the mock does not exist yet and no struct name is configured\n")
+	assert.Contains(t, stderr, "Error: 1 of 2 mocks failed\n")
+
+	err = copy.Copy("./test/inputfix/existing", "./test/inputfix/example/examplemock")
+	require.NoError(t, err, "error in test setup")
+
+	code, stdout, stderr := runCLI("sync", "-config", path, "-diff")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, "--- a/test/inputfix/example/examplemock/testmock.go\n")
+	assert.Contains(t, stdout, "--- /dev/null\n+++ b"+output+"/examplermock.go\n")
+	assert.Contains(t, stderr, "Success! 2 of 2 mocks changed.")
+	assert.NoDirExists(t, output)
+
+	code, stdout, stderr = runCLI("sync", "-config", path)
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, output+"/examplermock.go (github.com/fastbill/go-mock-gen/test/inputnew/example.Exampler) created\n  added:       FunctionA, FunctionC, FunctionZ\n")
+	assert.Contains(t, stdout, "Success! 2 of 2 mocks changed.")
+	assert.FileExists(t, filepath.Join(output, "examplermock.go"))
+
+	expected, err := ioutil.ReadFile("./test/expectedfix/result.go")
+	require.NoError(t, err, "error in test setup")
+	actual, err := ioutil.ReadFile("./test/inputfix/example/examplemock/testmock.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+
+	code, stdout, _ = runCLI("sync", "-config", path)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "Syncing 2 mocks...\nSuccess! 0 of 2 mocks changed.\n", stdout)
+}
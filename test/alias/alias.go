@@ -0,0 +1,22 @@
+package alias
+
+import (
+	"github.com/fastbill/go-mock-gen/test/alias/ids"
+	"github.com/fastbill/go-mock-gen/test/inputnew/model"
+)
+
+// UserID is an alias for a type of another package.
+type UserID = ids.ID
+
+// Users is an alias for a composite type.
+type Users = map[UserID][]*model.StructA
+
+// userKey is an unexported alias, so mocks in other packages use the aliased type.
+type userKey = ids.Key
+
+// Directory uses aliases in its signatures.
+type Directory interface {
+	Lookup(id UserID, key ids.Key) (Users, error)
+	Any(value any) any
+	Hidden(key userKey) []userKey
+}
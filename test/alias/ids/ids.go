@@ -0,0 +1,7 @@
+package ids
+
+// ID identifies a user.
+type ID string
+
+// Key is an alias for a basic type.
+type Key = string
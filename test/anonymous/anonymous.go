@@ -0,0 +1,32 @@
+package anonymous
+
+import (
+	"context"
+	"io"
+
+	"github.com/fastbill/go-mock-gen/test/inputnew/model"
+)
+
+// Service uses anonymous struct, interface and function types in its signatures.
+type Service interface {
+	Decode(input struct {
+		Name  string `json:"name"`
+		Count int    "json:\"count,omitempty\" quote:\"`\""
+		model.StructA
+		*model.StructB
+	}) error
+	Open(name string) (interface {
+		io.Reader
+		Close() error
+		Stat(ctx context.Context, keys ...string) (size int64, err error)
+	}, error)
+	Visit(fn func(ctx context.Context, items ...*model.StructA) (int, error)) func(string) (found bool)
+	Empty(struct{}, interface{}) []struct {
+		ID string `db:"id"`
+	}
+}
+
+// Hidden uses an anonymous struct with an unexported field, so it can only be mocked in its own package.
+type Hidden interface {
+	Use(options struct{ secret string })
+}
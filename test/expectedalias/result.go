@@ -0,0 +1,47 @@
+package aliasmock
+
+import (
+	"github.com/fastbill/go-mock-gen/test/alias"
+	"github.com/fastbill/go-mock-gen/test/alias/ids"
+	"github.com/stretchr/testify/mock"
+)
+
+// DirectoryMock is a mock implementation of the alias.Directory interface.
+//
+//mockgen:interface github.com/fastbill/go-mock-gen/test/alias.Directory struct=DirectoryMock
+type DirectoryMock struct {
+	mock.Mock
+}
+
+// Any is a mock implementation of alias.Directory#Any.
+func (m *DirectoryMock) Any(value any) any {
+	args := m.Called(value)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(any)
+	}
+
+	return nil
+}
+
+// Hidden is a mock implementation of alias.Directory#Hidden.
+func (m *DirectoryMock) Hidden(key string) []string {
+	args := m.Called(key)
+
+	if args.Get(0) != nil {
+		return args.Get(0).([]string)
+	}
+
+	return nil
+}
+
+// Lookup is a mock implementation of alias.Directory#Lookup.
+func (m *DirectoryMock) Lookup(id alias.UserID, key ids.Key) (alias.Users, error) {
+	args := m.Called(id, key)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(alias.Users), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
@@ -0,0 +1,73 @@
+package anonymousmock
+
+import (
+	"context"
+	"io"
+
+	"github.com/fastbill/go-mock-gen/test/inputnew/model"
+	"github.com/stretchr/testify/mock"
+)
+
+// ServiceMock is a mock implementation of the anonymous.Service interface.
+//
+//mockgen:interface github.com/fastbill/go-mock-gen/test/anonymous.Service struct=ServiceMock
+type ServiceMock struct {
+	mock.Mock
+}
+
+// Decode is a mock implementation of anonymous.Service#Decode.
+func (m *ServiceMock) Decode(input struct {
+	Name  string `json:"name"`
+	Count int    "json:\"count,omitempty\" quote:\"`\""
+	model.StructA
+	*model.StructB
+}) error {
+	args := m.Called(input)
+
+	return args.Error(0)
+}
+
+// Empty is a mock implementation of anonymous.Service#Empty.
+func (m *ServiceMock) Empty(_a0 struct{}, _a1 interface{}) []struct {
+	ID string `db:"id"`
+} {
+	args := m.Called(_a0, _a1)
+
+	if args.Get(0) != nil {
+		return args.Get(0).([]struct {
+			ID string `db:"id"`
+		})
+	}
+
+	return nil
+}
+
+// Open is a mock implementation of anonymous.Service#Open.
+func (m *ServiceMock) Open(name string) (interface {
+	io.Reader
+	Close() error
+	Stat(ctx context.Context, keys ...string) (size int64, err error)
+}, error) {
+	args := m.Called(name)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(interface {
+			io.Reader
+			Close() error
+			Stat(ctx context.Context, keys ...string) (size int64, err error)
+		}), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// Visit is a mock implementation of anonymous.Service#Visit.
+func (m *ServiceMock) Visit(fn func(ctx context.Context, items ...*model.StructA) (int, error)) func(string) (found bool) {
+	args := m.Called(fn)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(func(string) (found bool))
+	}
+
+	return nil
+}
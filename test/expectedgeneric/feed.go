@@ -0,0 +1,60 @@
+package genericmock
+
+import (
+	"sync/atomic"
+
+	"github.com/fastbill/go-mock-gen/test/generic"
+	"github.com/fastbill/go-mock-gen/test/inputnew/model"
+	"github.com/stretchr/testify/mock"
+)
+
+// FeedMock is a mock implementation of the generic.Feed interface.
+//
+//mockgen:interface github.com/fastbill/go-mock-gen/test/generic.Feed struct=FeedMock
+type FeedMock[T any] struct {
+	mock.Mock
+}
+
+// Latest is a mock implementation of generic.Feed#Latest.
+func (m *FeedMock[T]) Latest() *atomic.Pointer[generic.Event] {
+	args := m.Called()
+
+	if args.Get(0) != nil {
+		return args.Get(0).(*atomic.Pointer[generic.Event])
+	}
+
+	return nil
+}
+
+// List is a mock implementation of generic.Feed#List.
+func (m *FeedMock[T]) List(query generic.Page[model.StructA]) (*generic.Page[*model.StructB], error) {
+	args := m.Called(query)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(*generic.Page[*model.StructB]), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// Nested is a mock implementation of generic.Feed#Nested.
+func (m *FeedMock[T]) Nested(pages map[string]generic.Page[generic.Page[T]]) []generic.Page[int] {
+	args := m.Called(pages)
+
+	if args.Get(0) != nil {
+		return args.Get(0).([]generic.Page[int])
+	}
+
+	return nil
+}
+
+// Swap is a mock implementation of generic.Feed#Swap.
+func (m *FeedMock[T]) Swap(value *atomic.Pointer[T]) generic.Handler[generic.Page[T]] {
+	args := m.Called(value)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(generic.Handler[generic.Page[T]])
+	}
+
+	return nil
+}
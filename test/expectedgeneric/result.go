@@ -0,0 +1,42 @@
+package genericmock
+
+import (
+	"github.com/fastbill/go-mock-gen/test/inputnew/model"
+	"github.com/stretchr/testify/mock"
+)
+
+// RepositoryMock is a mock implementation of the generic.Repository interface.
+//
+//mockgen:interface github.com/fastbill/go-mock-gen/test/generic.Repository struct=RepositoryMock
+type RepositoryMock[T any] struct {
+	mock.Mock
+}
+
+// Find is a mock implementation of generic.Repository#Find.
+func (m *RepositoryMock[T]) Find(filter *model.StructA) ([]T, int) {
+	args := m.Called(filter)
+
+	if args.Get(0) != nil {
+		return args.Get(0).([]T), args.Int(1)
+	}
+
+	return nil, args.Int(1)
+}
+
+// Get is a mock implementation of generic.Repository#Get.
+func (m *RepositoryMock[T]) Get(id string) (T, error) {
+	args := m.Called(id)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(T), args.Error(1)
+	}
+
+	return *new(T), args.Error(1)
+}
+
+// Save is a mock implementation of generic.Repository#Save.
+func (m *RepositoryMock[T]) Save(item T) error {
+	args := m.Called(item)
+
+	return args.Error(0)
+}
@@ -6,6 +6,8 @@ import (
 )
 
 // TestMock is a mock implementation of the example.Exampler interface.
+//
+//mockgen:interface github.com/fastbill/go-mock-gen/test/inputnew/example.Exampler struct=TestMock
 type TestMock struct {
 	mock.Mock
 }
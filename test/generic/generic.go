@@ -0,0 +1,24 @@
+package generic
+
+import "github.com/fastbill/go-mock-gen/test/inputnew/model"
+
+// Repository is a generic interface for the test.
+type Repository[T any] interface {
+	Get(id string) (T, error)
+	Save(item T) error
+	Find(filter *model.StructA) ([]T, int)
+}
+
+// Number is a constraint for the test.
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+// Cache is a generic interface with several type parameters and constraints.
+type Cache[K comparable, V Number] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V)
+}
+
+// Handler is a generic function type.
+type Handler[T any] func(item T) error
@@ -0,0 +1,26 @@
+package generic
+
+import (
+	"sync/atomic"
+
+	"github.com/fastbill/go-mock-gen/test/inputnew/model"
+)
+
+// Page is a generic struct that is used with type arguments in the signatures below.
+type Page[T any] struct {
+	Items []T
+	Next  string
+}
+
+// Event is a type of this package that is used as a type argument.
+type Event struct {
+	Name string
+}
+
+// Feed uses instantiated generic types, also with the type parameter of the interface as type argument.
+type Feed[T any] interface {
+	List(query Page[model.StructA]) (*Page[*model.StructB], error)
+	Latest() *atomic.Pointer[Event]
+	Swap(value *atomic.Pointer[T]) Handler[Page[T]]
+	Nested(pages map[string]Page[Page[T]]) []Page[int]
+}
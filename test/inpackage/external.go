@@ -0,0 +1,6 @@
+package store
+
+// Lister only uses exported types, so it can be mocked in the external test package.
+type Lister interface {
+	List(prefix string) ([]*Item, error)
+}
@@ -0,0 +1,21 @@
+package store
+
+// Item is stored by the Storer.
+type Item struct {
+	Name string
+}
+
+type record struct {
+	ID int
+}
+
+// Storer uses types of its own package, including unexported ones.
+type Storer interface {
+	Get(id int) (*Item, error)
+	Find(r *record) ([]Item, error)
+}
+
+// itemCache is unexported itself but only uses exported types, so its mock can be in another package.
+type itemCache interface {
+	Get(id int) (*Item, error)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// packageImporter resolves imports with already loaded packages. It is used to type check mock files with
+// the packages the interface depends on, so the types in the signatures of the mock methods are identical
+// to the ones in the interface.
+type packageImporter map[string]*types.Package
+
+func newPackageImporter(pkg *types.Package) packageImporter {
+	imp := packageImporter{}
+	imp.add(pkg)
+	return imp
+}
+
+func (imp packageImporter) add(pkg *types.Package) {
+	if _, ok := imp[pkg.Path()]; ok {
+		return
+	}
+
+	imp[pkg.Path()] = pkg
+	for _, dep := range pkg.Imports() {
+		imp.add(dep)
+	}
+}
+
+// Import implements types.Importer.
+func (imp packageImporter) Import(path string) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if pkg, ok := imp[path]; ok {
+		return pkg, nil
+	}
+	return nil, fmt.Errorf("package %s is not used by the interface", path)
+}
+
+// localImporter is used for mocks that are part of the package of the interface. The declarations of that
+// package are visible in the mock without import.
+type localImporter struct {
+	packageImporter
+	local *types.Package
+}
+
+// typeCheck type checks the mock file on its own. Type errors are only recorded because the file does not need
+// to compile as a whole, e.g. imports that the interface does not use can not be resolved. Mostly the
+// signatures of the methods are of interest.
+func (s *mockSource) typeCheck(imp types.Importer) {
+	if s.info != nil {
+		return
+	}
+
+	s.info = &types.Info{Defs: map[*ast.Ident]types.Object{}, Uses: map[*ast.Ident]types.Object{}}
+	s.importer = imp
+	conf := &types.Config{Importer: imp, Error: func(err error) {
+		if typeErr, ok := err.(types.Error); ok {
+			s.typeErrors = append(s.typeErrors, typeErr)
+		}
+	}}
+	pkg := types.NewPackage(s.file.Name.Name, s.file.Name.Name)
+	if local, ok := imp.(localImporter); ok {
+		pkg = types.NewPackage(local.local.Path(), local.local.Name())
+		declareLocal(pkg, local.local, s.file)
+	}
+	_ = types.NewChecker(conf, s.fset, pkg, s.info).Files([]*ast.File{s.file})
+}
+
+// declareLocal makes the declarations of the local package visible in the package of the mock file. The ones that
+// the mock file declares itself, like the mock struct, are left out because the loaded package already contains
+// the existing mock.
+func declareLocal(pkg, local *types.Package, file *ast.File) {
+	declared := map[string]bool{}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					declared[spec.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						declared[name.Name] = true
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				declared[decl.Name.Name] = true
+			}
+		}
+	}
+
+	for _, name := range local.Scope().Names() {
+		if !declared[name] {
+			pkg.Scope().Insert(local.Scope().Lookup(name))
+		}
+	}
+}
+
+// typeOf returns the type checked signature of the method or nil if it is not available or contains
+// types that could not be resolved.
+func (s *mockSource) typeOf(fn *ast.FuncDecl) *types.Signature {
+	if s.info == nil {
+		return nil
+	}
+
+	obj, ok := s.info.Defs[fn.Name].(*types.Func)
+	if !ok {
+		return nil
+	}
+
+	sig := obj.Type().(*types.Signature)
+	if strings.Contains(types.TypeString(sig, nil), "invalid type") {
+		return nil
+	}
+	return sig
+}
+
+// objectOf returns the object the identifier defines or refers to or nil if it is unknown.
+func (s *mockSource) objectOf(ident *ast.Ident) types.Object {
+	if s.info == nil {
+		return nil
+	}
+	if obj := s.info.Defs[ident]; obj != nil {
+		return obj
+	}
+	return s.info.Uses[ident]
+}
+
+// identicalTypes reports whether both types are identical. Type parameters of generic mocks are declared
+// again by the receiver of every method, so they are compared by their name and constraint instead.
+func identicalTypes(a, b types.Type) bool {
+	if types.Identical(a, b) {
+		return true
+	}
+	qualifier := func(pkg *types.Package) string { return pkg.Path() }
+	return hasTypeParams(a) && types.TypeString(a, qualifier) == types.TypeString(b, qualifier)
+}
+
+// hasTypeParams reports whether the type refers to a type parameter.
+func hasTypeParams(typ types.Type) bool {
+	switch t := typ.(type) {
+	case *types.TypeParam:
+		return true
+	case *types.Alias:
+		return hasTypeParams(types.Unalias(t))
+	case *types.Signature:
+		return hasTypeParams(t.Params()) || hasTypeParams(t.Results())
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if hasTypeParams(t.At(i).Type()) {
+				return true
+			}
+		}
+	case *types.Pointer:
+		return hasTypeParams(t.Elem())
+	case *types.Slice:
+		return hasTypeParams(t.Elem())
+	case *types.Array:
+		return hasTypeParams(t.Elem())
+	case *types.Chan:
+		return hasTypeParams(t.Elem())
+	case *types.Map:
+		return hasTypeParams(t.Key()) || hasTypeParams(t.Elem())
+	case *types.Named:
+		args := t.TypeArgs()
+		for i := 0; i < args.Len(); i++ {
+			if hasTypeParams(args.At(i)) {
+				return true
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if hasTypeParams(t.Field(i).Type()) {
+				return true
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumMethods(); i++ {
+			if hasTypeParams(t.Method(i).Type()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeErrorsIn returns the messages of the type errors between the two offsets of the file.
+func (s *mockSource) typeErrorsIn(from, to int) []string {
+	messages := []string{}
+	for _, err := range s.typeErrors {
+		offset := err.Fset.Position(err.Pos).Offset
+		if offset >= from && offset < to {
+			messages = append(messages, err.Msg)
+		}
+	}
+	return messages
+}